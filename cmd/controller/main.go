@@ -1,119 +1,520 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
+	"maps"
 	"os"
+	"os/signal"
+	"reflect"
+	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes"
 
+	"github.com/joe-l-mathew/kube-resource-suggest/pkg/applier"
 	"github.com/joe-l-mathew/kube-resource-suggest/pkg/client"
+	"github.com/joe-l-mathew/kube-resource-suggest/pkg/cluster"
+	"github.com/joe-l-mathew/kube-resource-suggest/pkg/config"
 	"github.com/joe-l-mathew/kube-resource-suggest/pkg/engine"
+	"github.com/joe-l-mathew/kube-resource-suggest/pkg/events"
+	"github.com/joe-l-mathew/kube-resource-suggest/pkg/health"
+	"github.com/joe-l-mathew/kube-resource-suggest/pkg/leader"
+	"github.com/joe-l-mathew/kube-resource-suggest/pkg/logging"
+	"github.com/joe-l-mathew/kube-resource-suggest/pkg/metrics"
+	"github.com/joe-l-mathew/kube-resource-suggest/pkg/permissions"
 	"github.com/joe-l-mathew/kube-resource-suggest/pkg/reporter"
 	"github.com/joe-l-mathew/kube-resource-suggest/pkg/scanner"
-
-	"k8s.io/client-go/dynamic"
-	"k8s.io/client-go/kubernetes"
+	"github.com/joe-l-mathew/kube-resource-suggest/pkg/status"
+	"github.com/joe-l-mathew/kube-resource-suggest/pkg/webhook"
 )
 
 var Version = "dev"
 
 func main() {
-	fmt.Println("==================================================")
-	fmt.Println("   Kube Resource Suggest Controller")
-	fmt.Printf("   Version: %s - Auto-Optimizing Your Cluster\n", Version)
-	fmt.Println("==================================================")
-
-	// 1. Connect
-	// 1. Connect
-	k8sClient, coreClient, err := client.Connect()
+	configPath := flag.String("config", os.Getenv("CONFIG_FILE"), "Path to the YAML config file (env CONFIG_FILE)")
+	kubeconfig := flag.String("kubeconfig", "", "Path to a kubeconfig file (default: in-cluster, then KUBECONFIG or ~/.kube/config)")
+	var flags apiFlags
+	flag.StringVar(&flags.context, "context", "", "Kubeconfig context to use")
+	flag.StringVar(&flags.user, "as", "", "Username to impersonate for all API requests")
+	flag.Var(&flags.groups, "as-group", "Group to impersonate, repeatable (requires --as)")
+	flag.Parse()
+
+	// 0. Configuration: file + env overrides + flags, validated before anything starts
+	cfg, err := config.Load(*configPath)
+	if err == nil {
+		flags.apply(cfg)
+		err = cfg.Validate()
+	}
 	if err != nil {
-		log.Fatalf("Error connecting to Kubernetes: %v", err)
+		logging.Setup("info", "text")
+		logging.Fatal("Invalid configuration", "path", *configPath, "error", err)
 	}
-	fmt.Println(" -> Connected to Kubernetes")
+	config.Set(cfg)
 
-	promURL := engine.GetPrometheusUrl()
-	fmt.Printf(" -> Using Prometheus URL: %s\n", promURL)
+	// Logging: the level can later be changed via the config file, or PUT /loglevel if allowed
+	if err := logging.Setup(cfg.Logging.Level, cfg.Logging.Format); err != nil {
+		logging.Fatal("Invalid logging configuration", "error", err)
+	}
+	slog.Info("Starting Kube Resource Suggest Controller", "version", Version, "config", *configPath)
+	if v := os.Getenv("BATCH_DELAY"); v != "" {
+		slog.Warn("BATCH_DELAY is deprecated, use prometheus.qps (PROMETHEUS_QPS) instead", "batchDelay", v, "prometheusQPS", cfg.Prometheus.QPS)
+	}
 
-	fmt.Println(" -> Starting Control Loop...")
-	fmt.Println("==================================================")
+	// Root context: cancelled on SIGTERM/SIGINT so in-flight work can wind down
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
 
-	// 2. Control Loop Configuration
-	scanIntervalStr := os.Getenv("SCAN_INTERVAL")
-	if scanIntervalStr == "" {
-		scanIntervalStr = "1h"
+	// 1. Connect (the local cluster also hosts leader election and health checks)
+	clientOpts := client.Options{
+		Kubeconfig:        *kubeconfig,
+		Context:           cfg.API.Context,
+		QPS:               float32(cfg.API.QPS),
+		Burst:             cfg.API.Burst,
+		ImpersonateUser:   cfg.API.Impersonate.User,
+		ImpersonateGroups: cfg.API.Impersonate.Groups,
 	}
-	scanInterval, err := time.ParseDuration(scanIntervalStr)
+	k8sClient, coreClient, err := client.Connect(clientOpts)
 	if err != nil {
-		fmt.Printf("Warning: Invalid SCAN_INTERVAL '%s', defaulting to 1h.\n", scanIntervalStr)
-		scanInterval = 1 * time.Hour
+		logging.Fatal("Error connecting to Kubernetes", "error", err)
+	}
+	slog.Info("Connected to Kubernetes", "context", cfg.API.Context, "qps", cfg.API.QPS, "burst", cfg.API.Burst,
+		"impersonateUser", cfg.API.Impersonate.User, "impersonateGroups", cfg.API.Impersonate.Groups)
+
+	clusters, err := cluster.Build(cfg, clientOpts, k8sClient, coreClient)
+	if err != nil {
+		logging.Fatal("Error connecting to clusters", "error", err)
+	}
+	if len(cfg.Clusters) > 0 {
+		slog.Info("Multi-cluster mode", "clusters", len(clusters), "hub", cfg.Hub.Enabled, "hubNamespace", cfg.Hub.Namespace)
+	}
+
+	leaderCfg := leader.GetConfig()
+	if cfg.NamespaceScoped() {
+		slog.Info("Namespace-scoped mode", "namespaces", cfg.WatchNamespaces, "fallback", cfg.FallbackSource())
+	}
+	checkPermissions(ctx, clusters, coreClient, cfg, leaderCfg)
+
+	// Self-test: make sure the configured series exist before relying on them
+	schema := engine.GetPrometheusSchema()
+	slog.Info("Using Prometheus schema", "cpuMetric", schema.CpuMetric, "memoryMetric", schema.MemoryMetric,
+		"namespaceLabel", schema.NamespaceLabel, "podLabel", schema.PodLabel, "containerLabel", schema.ContainerLabel)
+	for _, cl := range clusters {
+		prom := cl.Prometheus()
+		log := cl.Logger().With("url", prom.URL, "tenant", prom.Tenant)
+		if err := engine.ValidatePrometheusSchema(ctx, prom, schema); err != nil {
+			log.Warn("Prometheus self-test failed", "error", err)
+		} else {
+			log.Info("Prometheus self-test passed")
+		}
+	}
+
+	// 2. Control Loop Configuration (re-read from the active config on every scan)
+	engine.SetPrometheusRateLimit(cfg.Prometheus.QPS, cfg.Prometheus.Burst)
+	slog.Info("Control loop configured", "scanInterval", cfg.ScanInterval, "workers", cfg.Workers,
+		"prometheusQPS", cfg.Prometheus.QPS, "prometheusBurst", cfg.Prometheus.Burst,
+		"workloadTimeout", cfg.WorkloadTimeout, "shutdownGracePeriod", cfg.ShutdownGracePeriod)
+
+	// 3. Health, readiness, metrics and (optional) pprof endpoints
+	checker := health.NewChecker(coreClient, cfg.ScanInterval.Duration, cfg.Health.MaxMissedScans)
+	mux := health.NewServeMux(checker, cfg.HTTP.Pprof)
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.Handle("/loglevel", logging.LevelHandler(func() bool { return config.Get().Logging.AllowLevelChange }))
+	trendSources := make(map[string]reporter.TrendSource, len(clusters))
+	for _, cl := range clusters {
+		trendSources[cl.Name] = reporter.TrendSource{Client: cl.Writer, Target: cl.Target}
+	}
+	mux.Handle("/trend", reporter.TrendHandler(trendSources))
+	go func() {
+		if err := health.Serve(ctx, cfg.HTTP.Addr, mux); err != nil {
+			logging.Fatal("HTTP server failed", "error", err)
+		}
+	}()
+	slog.Info("Serving /healthz, /readyz, /metrics, /loglevel and /trend", "addr", cfg.HTTP.Addr, "pprof", cfg.HTTP.Pprof)
+
+	// Optional admission webhook, served by every replica: it only reads suggestions
+	if cfg.Webhook.Enabled {
+		startWebhook(ctx, cfg, clientOpts, clusters, coreClient)
 	}
 
-	batchDelayStr := os.Getenv("BATCH_DELAY")
-	if batchDelayStr == "" {
-		batchDelayStr = "250ms"
+	// 4. Hot reload: a changed, valid config file applies from the next scan
+	go config.Watch(ctx, *configPath, configPollInterval, func(newCfg *config.Config) {
+		flags.apply(newCfg)
+		applyConfig(config.Get(), newCfg, checker)
+	})
+
+	// 5. Events: scan status on the controller's own Pod, and suggestion changes on workloads
+	recorder, stopEvents := events.NewRecorder(coreClient)
+	defer stopEvents()
+	statusReporter := status.NewReporter(coreClient, recorder, os.Getenv("POD_NAMESPACE"), os.Getenv("POD_NAME"), os.Getenv("POD_UID"))
+	for _, cl := range clusters {
+		if cl.CoreClient == coreClient {
+			cl.Target.Recorder = recorder
+			continue
+		}
+		clusterRecorder, stopClusterEvents := events.NewRecorder(cl.CoreClient)
+		defer stopClusterEvents()
+		cl.Target.Recorder = clusterRecorder
 	}
-	batchDelay, err := time.ParseDuration(batchDelayStr)
+
+	// 6. Run the loop, guarded by leader election when multiple replicas are deployed
+	err = leader.Run(ctx, coreClient, leaderCfg, func(ctx context.Context) {
+		checker.SetLeading(true)
+		defer checker.SetLeading(false)
+		runControlLoop(ctx, clusters, checker, statusReporter)
+	}, checker.SetLeader)
 	if err != nil {
-		fmt.Printf("Warning: Invalid BATCH_DELAY '%s', defaulting to 250ms.\n", batchDelayStr)
-		batchDelay = 250 * time.Millisecond
+		logging.Fatal("Leader election failed", "error", err)
+	}
+	slog.Info("Shutdown complete")
+}
+
+// startWebhook serves the admission webhook with the suggestions of the local cluster. It reads
+// them with its own client and token bucket, from the hub in hub mode.
+func startWebhook(ctx context.Context, cfg *config.Config, base client.Options, clusters []*cluster.Cluster, local kubernetes.Interface) {
+	opts := cfg.Webhook
+	for _, cl := range clusters {
+		if cl.CoreClient != local {
+			continue
+		}
+		clientOpts := base
+		clientOpts.QPS, clientOpts.Burst = float32(opts.QPS), opts.Burst
+		if cfg.Hub.Enabled && len(cfg.Clusters) > 0 && (cfg.Hub.Kubeconfig != "" || cfg.Hub.Context != "") {
+			clientOpts.Kubeconfig, clientOpts.Context = cfg.Hub.Kubeconfig, cfg.Hub.Context
+		}
+		reader, _, err := client.Connect(clientOpts)
+		if err != nil {
+			logging.Fatal("Error creating the webhook client", "error", err)
+		}
+		handler := webhook.Handler(reporter.TrendSource{Client: reader, Target: cl.Target}, opts.Timeout.Duration)
+		go func() {
+			if err := webhook.Serve(ctx, opts.Addr, opts.CertDir, handler); err != nil {
+				logging.Fatal("Webhook server failed", "error", err)
+			}
+		}()
+		slog.Info("Serving the resource injection webhook", "addr", opts.Addr, "path", webhook.Path, "qps", opts.QPS, "burst", opts.Burst)
+		return
+	}
+	slog.Warn("Webhook not started: the local cluster is not among the scanned clusters")
+}
+
+// checkPermissions reports any RBAC permissions the controller lacks, per cluster.
+// Missing permissions are logged rather than fatal, since they may be granted later.
+func checkPermissions(ctx context.Context, clusters []*cluster.Cluster, local kubernetes.Interface, cfg *config.Config, leaderCfg leader.Config) {
+	report := func(log *slog.Logger, client kubernetes.Interface, reqs []permissions.Requirement) {
+		missing, err := permissions.Check(ctx, client, reqs)
+		if err != nil {
+			log.Warn("Could not check permissions", "error", err)
+			return
+		}
+		for _, r := range missing {
+			log.Error("Missing permission", "permission", r.String(), "neededFor", r.Why)
+		}
+		if len(missing) > 0 {
+			log.Warn("Some permissions are missing; affected features will fail", "missing", len(missing), "of", len(reqs))
+		} else {
+			log.Info("All required permissions granted", "checked", len(reqs))
+		}
+	}
+
+	for _, cl := range clusters {
+		report(cl.Logger(), cl.CoreClient, permissions.Required(cfg))
+	}
+	if leaderCfg.Enabled {
+		report(slog.Default(), local, permissions.LeaderElection(leaderCfg.Namespace))
+	}
+	if ns := os.Getenv("POD_NAMESPACE"); ns != "" {
+		report(slog.Default(), local, permissions.ControllerStatus(ns))
+	}
+}
+
+// configPollInterval is how often the config file is checked for changes.
+// Kubelet itself takes up to a minute to project ConfigMap updates.
+const configPollInterval = 10 * time.Second
+
+// applyConfig activates a reloaded configuration and warns about settings that need a restart
+func applyConfig(old, cfg *config.Config, checker *health.Checker) {
+	config.Set(cfg)
+	if err := logging.SetLevel(cfg.Logging.Level); err != nil {
+		slog.Warn("Invalid log level in reloaded config", "error", err)
+	}
+	engine.SetPrometheusRateLimit(cfg.Prometheus.QPS, cfg.Prometheus.Burst)
+	checker.SetScanPolicy(cfg.ScanInterval.Duration, cfg.Health.MaxMissedScans)
+
+	if old.Logging.Format != cfg.Logging.Format || !reflect.DeepEqual(old.API, cfg.API) ||
+		old.HTTP != cfg.HTTP || old.Webhook != cfg.Webhook || old.LeaderElection != cfg.LeaderElection ||
+		!reflect.DeepEqual(old.Clusters, cfg.Clusters) || old.Hub != cfg.Hub {
+		slog.Warn("Changes to logging.format, api, http, webhook, leaderElection, clusters or hub take effect after a restart")
+	}
+}
+
+// apiFlags are command-line overrides for the api section of the config
+type apiFlags struct {
+	context string
+	user    string
+	groups  stringList
+}
+
+// apply copies the flags that were set onto cfg
+func (f *apiFlags) apply(cfg *config.Config) {
+	if f.context != "" {
+		cfg.API.Context = f.context
+	}
+	if f.user != "" {
+		cfg.API.Impersonate.User = f.user
+	}
+	if len(f.groups) > 0 {
+		cfg.API.Impersonate.Groups = f.groups
 	}
+}
+
+// stringList is a repeatable string flag
+type stringList []string
 
-	fmt.Printf(" -> Config: Scan Interval = %s, Batch Delay = %s\n", scanInterval, batchDelay)
-	fmt.Println("==================================================")
+func (l *stringList) String() string { return strings.Join(*l, ",") }
 
-	var lastWorkloadCount int = -1
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
 
+// runControlLoop scans and reports until ctx is cancelled (shutdown or leadership lost).
+// Clusters are scanned one after another; a cluster that fails to list is skipped until the next scan.
+func runControlLoop(ctx context.Context, clusters []*cluster.Cluster, checker *health.Checker, statusReporter *status.Reporter) {
 	for {
-		// Call the Scanner
-		workloads, err := scanner.ListWorkloads(k8sClient)
-		if err != nil {
-			log.Printf("Error scanning: %v", err)
-			time.Sleep(10 * time.Second) // Retry quicker on error
+		cfg := config.Get()
+		scanInterval := cfg.ScanInterval.Duration
+
+		start := time.Now()
+		metrics.BeginScan()
+		var failed, problems []string
+		workloadCount, changesCount := 0, 0
+
+		for _, cl := range clusters {
+			// Call the Scanner (an empty cluster is a valid, successful scan)
+			result, err := scanner.ListWorkloads(ctx, cl.Client)
+			if err != nil || ctx.Err() != nil {
+				return
+			}
+			metrics.RecordListResult(cl.Name, result.Counts, result.Errors)
+
+			if result.Partial() {
+				problems = append(problems, listProblems(cl, result)...)
+			}
+			if result.Failed() {
+				cl.Logger().Error("Error scanning", "error", result.Err())
+				metrics.ClusterScanErrors.WithLabelValues(cl.Name).Inc()
+				failed = append(failed, cl.Name)
+				continue
+			}
+			if result.Partial() {
+				cl.Logger().Warn("Scan partially failed; continuing with the workloads that were listed", "error", result.Err(), "workloads", len(result.Workloads))
+			}
+
+			workloadCount += len(result.Workloads)
+			rollup := reporter.NewRollup()
+			changesCount += runScan(ctx, cl, result.Workloads, cfg, rollup)
+			if ctx.Err() != nil {
+				return
+			}
+
+			// Orphans can only be told apart from unlisted workloads after a complete scan
+			if !result.Partial() {
+				scope := reporter.Scope{WatchNamespaces: result.WatchNamespaces, IgnoredNamespaces: result.IgnoredNamespaces}
+				collected, err := reporter.CollectGarbage(ctx, cl.Writer, cl.Target, scope, result.Workloads, cfg.GarbageCollection)
+				if err != nil {
+					cl.Logger().Error("Error collecting orphaned suggestions", "error", err)
+				}
+				if collected > 0 {
+					cl.Logger().Info("Collected orphaned suggestions", "count", collected, "mode", cfg.GarbageCollection)
+				}
+
+				if cfg.Reports.Enabled {
+					if err := reporter.WriteReports(ctx, cl.Writer, cl.Target, rollup, cfg.WatchNamespaces, cfg.Reports.TopN); err != nil {
+						cl.Logger().Error("Error writing reports", "error", err)
+					}
+				}
+			}
+		}
+		duration := time.Since(start)
+		statusReporter.ScanFinished(ctx, problems, len(failed) == len(clusters))
+
+		if len(failed) == len(clusters) {
+			if !sleepOrDone(ctx, 10*time.Second) { // Retry quicker on error
+				return
+			}
 			continue
 		}
+		metrics.EndScan(failed...)
+		metrics.ObserveScan(duration, scanInterval)
+		checker.ScanCompleted()
 
-		if len(workloads) != lastWorkloadCount {
-			lastWorkloadCount = len(workloads)
+		slog.Info("Scan complete", "workloads", workloadCount, "changes", changesCount, "duration", duration.Round(time.Millisecond),
+			"clusters", len(clusters), "failedClusters", failed, "partial", len(problems) > 0)
+		if duration > scanInterval {
+			slog.Warn("Scan took longer than the scan interval; consider more workers or higher rate limits",
+				"duration", duration.Round(time.Second), "scanInterval", scanInterval, "behind", (duration - scanInterval).Round(time.Second))
 		}
 
-		changesCount := 0
-		for _, w := range workloads {
-			changesCount += processWorkload(k8sClient, coreClient, w)
-			// Rate Limiting: Sleep between processing items to avoid throttling
-			time.Sleep(batchDelay)
+		// Keep a steady cadence: the scan time counts towards the interval
+		if !sleepOrDone(ctx, max(scanInterval-duration, 0)) {
+			return
 		}
+	}
+}
 
-		if changesCount > 0 {
-			// Optional: log summary
+// listProblems describes each resource type that failed to list, prefixed with the cluster name in multi-cluster mode
+func listProblems(cl *cluster.Cluster, result *scanner.ScanResult) []string {
+	prefix := ""
+	if cl.Name != "" {
+		prefix = "cluster " + cl.Name + ": "
+	}
+	var problems []string
+	for _, resource := range slices.Sorted(maps.Keys(result.Errors)) {
+		msg := strings.ReplaceAll(result.Errors[resource].Error(), "\n", "; ")
+		problems = append(problems, fmt.Sprintf("%s%s: %s", prefix, resource, msg))
+	}
+	return problems
+}
+
+// runScan processes workloads with a bounded pool of workers and returns the number of changes.
+// API-server and Prometheus calls are throttled by shared token buckets, not by the workers.
+// Once ctx is cancelled no new workloads are started, and in-flight ones get the grace period to finish.
+func runScan(ctx context.Context, cl *cluster.Cluster, workloads []unstructured.Unstructured, cfg *config.Config, rollup *reporter.Rollup) int {
+	workCtx, cancelWork := graceContext(ctx, cfg.ShutdownGracePeriod.Duration)
+	defer cancelWork()
+
+	queue := make(chan unstructured.Unstructured)
+	var changes atomic.Int64
+	var wg sync.WaitGroup
+
+	for i := 0; i < cfg.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for w := range queue {
+				wctx, cancel := context.WithTimeout(workCtx, cfg.WorkloadTimeout.Duration)
+				changes.Add(int64(processWorkload(wctx, cl, w, rollup)))
+				cancel()
+			}
+		}()
+	}
+
+feed:
+	for _, w := range workloads {
+		select {
+		case <-ctx.Done():
+			break feed
+		case queue <- w:
 		}
+	}
+	close(queue)
+	wg.Wait()
 
-		// fmt.Printf("[%s] Scan complete. Sleeping for %s...\n", time.Now().Format("15:04:05"), scanInterval)
-		time.Sleep(scanInterval)
+	return int(changes.Load())
+}
+
+// graceContext returns a context that is cancelled grace after ctx, letting in-flight work finish
+func graceContext(ctx context.Context, grace time.Duration) (context.Context, context.CancelFunc) {
+	workCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stop := context.AfterFunc(ctx, func() {
+		slog.Info("Shutting down, waiting for in-flight workloads", "gracePeriod", grace)
+		time.AfterFunc(grace, cancel)
+	})
+	return workCtx, func() {
+		stop()
+		cancel()
 	}
 }
 
-func processWorkload(k8sClient dynamic.Interface, coreClient *kubernetes.Clientset, w unstructured.Unstructured) int {
-	suggestions := engine.GenerateLogic(k8sClient, coreClient, w)
+// sleepOrDone waits for d and returns false if ctx was cancelled first
+func sleepOrDone(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+func processWorkload(ctx context.Context, cl *cluster.Cluster, w unstructured.Unstructured, rollup *reporter.Rollup) int {
+	suggestions := engine.GenerateLogic(ctx, cl.Client, cl.CoreClient, cl.Prometheus(), w)
+	metrics.WorkloadsProcessed.Inc()
 	changes := 0
 
-	for _, suggestion := range suggestions {
-		// Report to Kubernetes (Create/Update CR)
-		updated, err := reporter.UpdateOrReport(k8sClient, w, suggestion)
+	if len(suggestions) == 0 && ctx.Err() == nil {
+		rollup.Add(w, nil)
+		// Keep the previous recommendation, but flag it as stale
+		err := reporter.MarkStale(ctx, cl.Writer, cl.Target, w, reporter.ReasonNoData, "No usage data in the last refresh; showing the previous recommendation")
 		if err != nil {
-			log.Printf("Error creating suggestion for %s: %v", suggestion.WorkloadName, err)
-		} else if updated {
-			// Only log updates in DEBUG mode
-			logLevel := strings.ToLower(os.Getenv("LOG_LEVEL"))
-			if logLevel == "debug" {
-				fmt.Printf("[UPDATE] %s/%s (%s)\n", suggestion.WorkloadType, suggestion.WorkloadName, suggestion.ContainerName)
-				fmt.Printf("    CPU: %s | Mem: %s | %s\n",
-					suggestion.CpuLimit, suggestion.MemoryLimit, suggestion.Status)
-			}
+			cl.Logger().Error("Error marking suggestion stale", "workload", w.GetName(), "namespace", w.GetNamespace(), "kind", w.GetKind(), "error", err)
+		}
+		return 0
+	}
+
+	// Report to Kubernetes (Create/Update CRs); this applies hysteresis to the suggestions
+	updated, errs := reporter.UpdateOrReport(ctx, cl.Writer, cl.Target, w, suggestions)
+	for i, suggestion := range suggestions {
+		log := cl.Logger().With("workload", suggestion.WorkloadName, "namespace", w.GetNamespace(), "kind", suggestion.WorkloadType,
+			"container", suggestion.ContainerName, "source", suggestion.Source)
+
+		recordSuggestionMetrics(cl.Name, w.GetNamespace(), suggestion)
+		if err := errs[i]; err != nil {
+			log.Error("Error reporting suggestion", "error", err)
+		} else if updated[i] {
+			log.Debug("Suggestion updated", "cpuLimit", suggestion.CpuLimit, "memoryLimit", suggestion.MemoryLimit, "status", suggestion.Status)
 			changes++
 		}
 	}
+	rollup.Add(w, suggestions)
+
+	// Opt-in auto-apply, after the suggestions are written
+	if cfg := config.Get(); cfg.AutoApply.Enabled && len(suggestions) > 0 && ctx.Err() == nil {
+		clients := applier.Clients{Dynamic: cl.Client, Core: cl.CoreClient, Recorder: cl.Target.Recorder}
+		outcome, err := applier.Apply(ctx, clients, cfg, w, suggestions, time.Now())
+		log := cl.Logger().With("workload", w.GetName(), "namespace", w.GetNamespace(), "kind", w.GetKind(), "outcome", outcome)
+		if err != nil {
+			log.Error("Error auto-applying suggestion", "error", err)
+		} else if outcome == applier.ReasonApplied {
+			log.Info("Auto-applied suggestion")
+		} else if outcome != "" {
+			log.Debug("Auto-apply skipped")
+		}
+		if outcome != "" {
+			metrics.AutoApply.WithLabelValues(cl.Name, outcome).Inc()
+		}
+	}
 	return changes
 }
+
+// recordSuggestionMetrics exports a suggestion's current and recommended values
+func recordSuggestionMetrics(clusterName, ns string, s *engine.SuggestionResult) {
+	key := metrics.ContainerKey{
+		Cluster:   clusterName,
+		Namespace: ns,
+		Workload:  s.WorkloadName,
+		Kind:      s.WorkloadType,
+		Container: s.ContainerName,
+	}
+	current := metrics.Resources{
+		CpuRequestNano:     s.CurrentCpuRequestNano,
+		CpuLimitNano:       s.CurrentCpuLimitNano,
+		MemoryRequestBytes: s.CurrentMemoryRequestBytes,
+		MemoryLimitBytes:   s.CurrentMemoryLimitBytes,
+	}
+	recommended := metrics.Resources{
+		CpuRequestNano:     s.TargetCpuRequestNano,
+		CpuLimitNano:       s.TargetCpuLimitNano,
+		MemoryRequestBytes: s.TargetMemoryRequestBytes,
+		MemoryLimitBytes:   s.TargetMemoryLimitBytes,
+	}
+	metrics.RecordSuggestion(key, s.Status, s.Source, current, recommended)
+}
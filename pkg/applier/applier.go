@@ -0,0 +1,304 @@
+package applier
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joe-l-mathew/kube-resource-suggest/pkg/config"
+	"github.com/joe-l-mathew/kube-resource-suggest/pkg/engine"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
+)
+
+// Annotation opts a workload, or every workload of a namespace, into auto-apply with "true".
+// "false" on a workload opts it out of its namespace's setting.
+const Annotation = "krs.io/auto-apply"
+
+// LastAppliedAnnotation records on the workload when auto-apply last changed it
+const LastAppliedAnnotation = "krs.io/last-auto-apply"
+
+// FieldManager owns the resources auto-apply sets on workloads
+const FieldManager = "krs-controller"
+
+// Outcomes of Apply, used as Event reasons and metric labels
+const (
+	ReasonApplied               = "AutoApplied"
+	ReasonNoChange              = "NoChange"
+	ReasonGitOpsManaged         = "GitOpsManaged"
+	ReasonDataTooNew            = "DataTooNew"
+	ReasonOutsideWindow         = "OutsideMaintenanceWindow"
+	ReasonCooldown              = "Cooldown"
+	ReasonNotReady              = "NotReady"
+	ReasonDisruptionBudget      = "DisruptionBudget"
+	ReasonDryRunFailed          = "AutoApplyDryRunFailed"
+	ReasonPatchFailed           = "AutoApplyFailed"
+	ReasonNamespaceLookupFailed = "NamespaceLookupFailed"
+	ReasonResizeFailed          = "InPlaceResizeFailed"
+	ReasonResizeInfeasible      = "InPlaceResizeInfeasible"
+)
+
+var workloadGVRs = map[string]schema.GroupVersionResource{
+	"Deployment":  {Group: "apps", Version: "v1", Resource: "deployments"},
+	"StatefulSet": {Group: "apps", Version: "v1", Resource: "statefulsets"},
+	"DaemonSet":   {Group: "apps", Version: "v1", Resource: "daemonsets"},
+}
+
+// Clients are the source cluster's clients that auto-apply uses
+type Clients struct {
+	Dynamic dynamic.Interface
+	Core    kubernetes.Interface
+	// Recorder records Events on changed workloads; nil disables them
+	Recorder record.EventRecorder
+}
+
+// Apply moves workload's resources towards its suggestions if the workload opted in and every
+// guardrail passes. Returns "" if the workload did not opt in, otherwise the outcome reason.
+// The error is set when the outcome could not be decided or the patch failed.
+func Apply(ctx context.Context, clients Clients, cfg *config.Config, workload unstructured.Unstructured, suggestions []*engine.SuggestionResult, now time.Time) (string, error) {
+	opts := cfg.AutoApply
+
+	// 1. Opt-in
+	enabled, err := optedIn(ctx, clients.Core, workload, !cfg.NamespaceScoped())
+	if err != nil {
+		return ReasonNamespaceLookupFailed, err
+	}
+	if !enabled {
+		return "", nil
+	}
+	if gitOpsManaged(workload) {
+		return ReasonGitOpsManaged, nil
+	}
+
+	// 2. Enough usage history
+	if now.Sub(workload.GetCreationTimestamp().Time) < opts.MinDataAge.Duration {
+		return ReasonDataTooNew, nil
+	}
+	for _, s := range suggestions {
+		if s.Window == engine.WindowInstant {
+			return ReasonDataTooNew, nil // Point-in-time fallback, no history
+		}
+	}
+
+	// 3. What would change, at most MaxChange per step
+	containers, changes := plan(suggestions, opts.MaxChange)
+	if len(containers) == 0 {
+		return ReasonNoChange, nil
+	}
+
+	// 4. When
+	if !inWindow(opts.MaintenanceWindow, now) {
+		return ReasonOutsideWindow, nil
+	}
+	if last, err := time.Parse(time.RFC3339, workload.GetAnnotations()[LastAppliedAnnotation]); err == nil && now.Sub(last) < opts.Cooldown.Duration {
+		return ReasonCooldown, nil
+	}
+
+	// 5. Disruption: patching the pod template rolls out new pods
+	if !settled(workload) {
+		return ReasonNotReady, nil
+	}
+	blocked, err := disruptionBlocked(ctx, clients.Core, workload)
+	if err != nil {
+		return ReasonDisruptionBudget, fmt.Errorf("failed to check PodDisruptionBudgets: %v", err)
+	}
+	if blocked {
+		return ReasonDisruptionBudget, nil
+	}
+
+	// 6. Validate with a server-side dry run
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{LastAppliedAnnotation: now.UTC().Format(time.RFC3339)},
+		},
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{"containers": containers},
+			},
+		},
+	})
+	if err != nil {
+		return ReasonPatchFailed, err
+	}
+	client := clients.Dynamic.Resource(workloadGVRs[workload.GetKind()]).Namespace(workload.GetNamespace())
+	opt := metav1.PatchOptions{FieldManager: FieldManager, DryRun: []string{metav1.DryRunAll}}
+	if _, err := client.Patch(ctx, workload.GetName(), types.StrategicMergePatchType, patch, opt); err != nil {
+		recordEvent(clients, &workload, corev1.EventTypeWarning, ReasonDryRunFailed, "Dry run rejected the recommended resources: %v", err)
+		return ReasonDryRunFailed, err
+	}
+
+	// 7. In-place mode: resize the running pods first, and stop if that is rolled back.
+	// A template change that would roll out new pods is left out, unless configured
+	if opts.Mode == config.ApplyInPlace {
+		resized, reason, err := resizePods(ctx, clients, workload, containers)
+		if reason != "" {
+			if reason == ReasonResizeFailed {
+				recordEvent(clients, &workload, corev1.EventTypeWarning, ReasonResizeFailed, "In-place resize failed: %v", err)
+			}
+			return reason, err
+		}
+		if resized > 0 {
+			changes = append(changes, fmt.Sprintf("resized %d running pod(s) in place", resized))
+		}
+		if rollsOut(workload) && !opts.PatchRollingTemplates {
+			if resized == 0 {
+				return ReasonNoChange, nil
+			}
+			// Only record the change, for the cooldown
+			changes = append(changes, "pod template left unchanged to avoid a rollout")
+			if patch, err = json.Marshal(map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"annotations": map[string]interface{}{LastAppliedAnnotation: now.UTC().Format(time.RFC3339)},
+				},
+			}); err != nil {
+				return ReasonPatchFailed, err
+			}
+		}
+	}
+
+	// 8. Apply to the template
+	opt.DryRun = nil
+	if _, err := client.Patch(ctx, workload.GetName(), types.StrategicMergePatchType, patch, opt); err != nil {
+		recordEvent(clients, &workload, corev1.EventTypeWarning, ReasonPatchFailed, "Failed to apply the recommended resources: %v", err)
+		return ReasonPatchFailed, err
+	}
+	recordEvent(clients, &workload, corev1.EventTypeNormal, ReasonApplied, "Applied recommended resources: %s", strings.Join(changes, "; "))
+	return ReasonApplied, nil
+}
+
+// rollsOut reports whether a change of workload's pod template replaces its pods: always for
+// Deployments, and for StatefulSets and DaemonSets unless their update strategy is OnDelete
+func rollsOut(workload unstructured.Unstructured) bool {
+	if workload.GetKind() == "Deployment" {
+		return true
+	}
+	strategy, _, _ := unstructured.NestedString(workload.Object, "spec", "updateStrategy", "type")
+	return strategy != "OnDelete"
+}
+
+// recordEvent records an Event on workload if a recorder is set
+func recordEvent(clients Clients, workload *unstructured.Unstructured, eventType, reason, format string, args ...interface{}) {
+	if clients.Recorder != nil {
+		clients.Recorder.Eventf(workload, eventType, reason, format, args...)
+	}
+}
+
+// namespaceTTL bounds how long a namespace's opt-in annotation is cached
+const namespaceTTL = time.Minute
+
+type namespaceOptIn struct {
+	value string
+	at    time.Time
+}
+
+// namespaces caches the auto-apply annotation by namespace
+var namespaces sync.Map
+
+// optedIn reports whether workload, or else its namespace (if readable), has auto-apply enabled
+func optedIn(ctx context.Context, core kubernetes.Interface, workload unstructured.Unstructured, readNamespace bool) (bool, error) {
+	if v, ok := workload.GetAnnotations()[Annotation]; ok {
+		return v == "true", nil
+	}
+	if !readNamespace {
+		return false, nil // Namespace-scoped mode cannot read Namespaces
+	}
+
+	ns := workload.GetNamespace()
+	if v, ok := namespaces.Load(ns); ok && time.Since(v.(namespaceOptIn).at) < namespaceTTL {
+		return v.(namespaceOptIn).value == "true", nil
+	}
+	obj, err := core.CoreV1().Namespaces().Get(ctx, ns, metav1.GetOptions{})
+	if err != nil {
+		return false, fmt.Errorf("failed to get namespace %s: %v", ns, err)
+	}
+	value := obj.Annotations[Annotation]
+	namespaces.Store(ns, namespaceOptIn{value: value, at: time.Now()})
+	return value == "true", nil
+}
+
+// plan returns the strategic-merge container entries moving each non-optimal container's
+// requests and limits towards its suggestion, and a description of the changes.
+// Values that are not set on the container are left unset.
+func plan(suggestions []*engine.SuggestionResult, maxChange float64) ([]interface{}, []string) {
+	var containers []interface{}
+	var changes []string
+	for _, s := range suggestions {
+		if s.Status == "Optimal" {
+			continue
+		}
+		cpuReq := step(s.CurrentCpuRequestNano, s.TargetCpuRequestNano, maxChange)
+		cpuLim := limitStep(s.CurrentCpuLimitNano, s.TargetCpuLimitNano, cpuReq, maxChange)
+		memReq := step(s.CurrentMemoryRequestBytes, s.TargetMemoryRequestBytes, maxChange)
+		memLim := limitStep(s.CurrentMemoryLimitBytes, s.TargetMemoryLimitBytes, memReq, maxChange)
+
+		requests, limits := map[string]interface{}{}, map[string]interface{}{}
+		var changed []string
+		set := func(m map[string]interface{}, key, label string, current, next int64, format func(int64) string) {
+			if next == 0 || format(next) == format(current) {
+				return
+			}
+			m[key] = format(next)
+			changed = append(changed, fmt.Sprintf("%s %s->%s", label, format(current), format(next)))
+		}
+		set(requests, "cpu", "CPU request", s.CurrentCpuRequestNano, cpuReq, cpuQuantity)
+		set(limits, "cpu", "CPU limit", s.CurrentCpuLimitNano, cpuLim, cpuQuantity)
+		set(requests, "memory", "memory request", s.CurrentMemoryRequestBytes, memReq, memoryQuantity)
+		set(limits, "memory", "memory limit", s.CurrentMemoryLimitBytes, memLim, memoryQuantity)
+		if len(changed) == 0 {
+			continue
+		}
+
+		resources := map[string]interface{}{}
+		if len(requests) > 0 {
+			resources["requests"] = requests
+		}
+		if len(limits) > 0 {
+			resources["limits"] = limits
+		}
+		containers = append(containers, map[string]interface{}{"name": s.ContainerName, "resources": resources})
+		changes = append(changes, fmt.Sprintf("container %s: %s", s.ContainerName, strings.Join(changed, ", ")))
+	}
+	return containers, changes
+}
+
+// step moves current towards target by at most maxChange of current. Returns 0 if either is unset.
+func step(current, target int64, maxChange float64) int64 {
+	if current == 0 || target == 0 {
+		return 0
+	}
+	limit := int64(float64(current) * maxChange)
+	return min(max(target, current-limit), current+limit)
+}
+
+// limitStep is step for a limit, which is never moved below the new request. Returns 0 if the limit is unset.
+func limitStep(current, target, request int64, maxChange float64) int64 {
+	if current == 0 {
+		return 0
+	}
+	next := step(current, target, maxChange)
+	if next == 0 {
+		next = current
+	}
+	return max(next, request)
+}
+
+// cpuQuantity formats CPU rounded up to millicores
+func cpuQuantity(nano int64) string {
+	return resource.NewMilliQuantity((nano+999999)/1000000, resource.DecimalSI).String()
+}
+
+// memoryQuantity formats memory rounded up to MiB
+func memoryQuantity(bytes int64) string {
+	const mi = 1024 * 1024
+	return resource.NewQuantity((bytes+mi-1)/mi*mi, resource.BinarySI).String()
+}
@@ -0,0 +1,114 @@
+package applier
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/joe-l-mathew/kube-resource-suggest/pkg/engine"
+)
+
+func TestStep(t *testing.T) {
+	tests := []struct {
+		name            string
+		current, target int64
+		maxChange       float64
+		want            int64
+	}{
+		{"within limit up", 1000, 1200, 0.5, 1200},
+		{"within limit down", 1000, 600, 0.5, 600},
+		{"clamped up", 1000, 3000, 0.5, 1500},
+		{"clamped down", 1000, 200, 0.5, 500},
+		{"unset current", 0, 500, 0.5, 0},
+		{"unset target", 1000, 0, 0.5, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := step(tt.current, tt.target, tt.maxChange); got != tt.want {
+				t.Errorf("step(%d, %d, %v) = %d, want %d", tt.current, tt.target, tt.maxChange, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLimitStep(t *testing.T) {
+	tests := []struct {
+		name                     string
+		current, target, request int64
+		want                     int64
+	}{
+		{"no limit stays unset", 0, 500, 300, 0},
+		{"clamped", 1000, 200, 300, 500},
+		{"floored at the new request", 1000, 200, 800, 800},
+		{"unset target keeps the limit", 1000, 0, 300, 1000},
+		{"unset target floored at the request", 1000, 0, 1200, 1200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := limitStep(tt.current, tt.target, tt.request, 0.5); got != tt.want {
+				t.Errorf("limitStep(%d, %d, %d) = %d, want %d", tt.current, tt.target, tt.request, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlan(t *testing.T) {
+	const mi = 1024 * 1024
+	tests := []struct {
+		name        string
+		suggestions []*engine.SuggestionResult
+		want        []interface{}
+		wantChanges []string
+	}{
+		{
+			name: "clamped, without adding a CPU limit",
+			suggestions: []*engine.SuggestionResult{{
+				ContainerName:             "api",
+				Status:                    "Overprovisioned",
+				CurrentCpuRequestNano:     1e9,
+				TargetCpuRequestNano:      250e6,
+				TargetCpuLimitNano:        250e6,
+				CurrentMemoryRequestBytes: 512 * mi,
+				TargetMemoryRequestBytes:  256 * mi,
+				CurrentMemoryLimitBytes:   1024 * mi,
+				TargetMemoryLimitBytes:    256 * mi,
+			}},
+			want: []interface{}{map[string]interface{}{
+				"name": "api",
+				"resources": map[string]interface{}{
+					"requests": map[string]interface{}{"cpu": "500m", "memory": "256Mi"},
+					"limits":   map[string]interface{}{"memory": "512Mi"},
+				},
+			}},
+			wantChanges: []string{"container api: CPU request 1->500m, memory request 512Mi->256Mi, memory limit 1Gi->512Mi"},
+		},
+		{
+			name: "optimal containers are left alone",
+			suggestions: []*engine.SuggestionResult{{
+				ContainerName:         "api",
+				Status:                "Optimal",
+				CurrentCpuRequestNano: 1e9,
+				TargetCpuRequestNano:  500e6,
+			}},
+		},
+		{
+			name: "decreases below a millicore round up to no change",
+			suggestions: []*engine.SuggestionResult{{
+				ContainerName:         "api",
+				Status:                "Overprovisioned",
+				CurrentCpuRequestNano: 100e6,
+				TargetCpuRequestNano:  100e6 - 1,
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, changes := plan(tt.suggestions, 0.5)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("plan() containers = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(changes, tt.wantChanges) {
+				t.Errorf("plan() changes = %q, want %q", changes, tt.wantChanges)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package applier
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/joe-l-mathew/kube-resource-suggest/pkg/config"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+// gitOpsPrefixes are label and annotation prefixes set by Argo CD and Flux on the objects they manage
+var gitOpsPrefixes = []string{
+	"argocd.argoproj.io/",
+	"kustomize.toolkit.fluxcd.io/",
+	"helm.toolkit.fluxcd.io/",
+}
+
+// gitOpsManagers are the field managers of Argo CD and Flux
+var gitOpsManagers = []string{
+	"argocd-controller",
+	"argocd-application-controller",
+	"kustomize-controller",
+	"helm-controller",
+}
+
+// gitOpsManaged reports whether Argo CD or Flux manages workload. They would revert our change,
+// or fight over it, so auto-apply never touches such workloads.
+func gitOpsManaged(workload unstructured.Unstructured) bool {
+	for _, m := range []map[string]string{workload.GetLabels(), workload.GetAnnotations()} {
+		for key := range m {
+			for _, prefix := range gitOpsPrefixes {
+				if strings.HasPrefix(key, prefix) {
+					return true
+				}
+			}
+		}
+	}
+	for _, f := range workload.GetManagedFields() {
+		for _, manager := range gitOpsManagers {
+			if f.Manager == manager {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// inWindow reports whether now is inside the maintenance window
+func inWindow(w config.MaintenanceWindow, now time.Time) bool {
+	loc, err := time.LoadLocation(w.TimeZone)
+	if err != nil {
+		return false // Rejected by config validation
+	}
+	now = now.In(loc)
+
+	day := now.Weekday()
+	if w.Start != "" {
+		start, _ := time.Parse(config.TimeOfDay, w.Start)
+		end, _ := time.Parse(config.TimeOfDay, w.End)
+		minute := now.Hour()*60 + now.Minute()
+		from, to := start.Hour()*60+start.Minute(), end.Hour()*60+end.Minute()
+		switch {
+		case from <= to:
+			if minute < from || minute >= to {
+				return false
+			}
+		case minute < to:
+			// Past midnight: the window started the day before
+			day = (day + 6) % 7
+		case minute < from:
+			return false
+		}
+	}
+
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, d := range w.Days {
+		if config.Weekdays[d] == day {
+			return true
+		}
+	}
+	return false
+}
+
+// settled reports whether workload's last rollout finished and all its pods are ready
+func settled(workload unstructured.Unstructured) bool {
+	observed, _, _ := unstructured.NestedInt64(workload.Object, "status", "observedGeneration")
+	if observed < workload.GetGeneration() {
+		return false
+	}
+
+	if workload.GetKind() == "DaemonSet" {
+		desired, _, _ := unstructured.NestedInt64(workload.Object, "status", "desiredNumberScheduled")
+		ready, _, _ := unstructured.NestedInt64(workload.Object, "status", "numberReady")
+		updated, _, _ := unstructured.NestedInt64(workload.Object, "status", "updatedNumberScheduled")
+		return ready == desired && updated == desired
+	}
+	desired, found, _ := unstructured.NestedInt64(workload.Object, "spec", "replicas")
+	if !found {
+		desired = 1
+	}
+	ready, _, _ := unstructured.NestedInt64(workload.Object, "status", "readyReplicas")
+	updated, _, _ := unstructured.NestedInt64(workload.Object, "status", "updatedReplicas")
+	return ready >= desired && updated >= desired
+}
+
+// disruptionBlocked reports whether a PodDisruptionBudget covering workload's pods allows no disruption now
+func disruptionBlocked(ctx context.Context, core kubernetes.Interface, workload unstructured.Unstructured) (bool, error) {
+	podLabels, _, _ := unstructured.NestedStringMap(workload.Object, "spec", "template", "metadata", "labels")
+	pdbs, err := core.PolicyV1().PodDisruptionBudgets(workload.GetNamespace()).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return false, err
+	}
+	for _, pdb := range pdbs.Items {
+		selector, err := metav1.LabelSelectorAsSelector(pdb.Spec.Selector)
+		if err != nil || !selector.Matches(labels.Set(podLabels)) {
+			continue
+		}
+		if pdb.Status.DisruptionsAllowed < 1 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,134 @@
+package applier
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/joe-l-mathew/kube-resource-suggest/pkg/config"
+	policyv1 "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestInWindow(t *testing.T) {
+	// 2026-10-16 is a Friday
+	at := func(day int, hour, minute int) time.Time {
+		return time.Date(2026, 10, day, hour, minute, 0, 0, time.UTC)
+	}
+	overnight := config.MaintenanceWindow{Days: []string{"Fri"}, Start: "22:00", End: "02:00", TimeZone: "UTC"}
+	daytime := config.MaintenanceWindow{Days: []string{"Sat", "Sun"}, Start: "02:00", End: "06:00", TimeZone: "UTC"}
+	tests := []struct {
+		name   string
+		window config.MaintenanceWindow
+		now    time.Time
+		want   bool
+	}{
+		{"any time", config.MaintenanceWindow{TimeZone: "UTC"}, at(16, 13, 0), true},
+		{"daytime inside", daytime, at(17, 3, 0), true},
+		{"daytime start is inclusive", daytime, at(17, 2, 0), true},
+		{"daytime end is exclusive", daytime, at(17, 6, 0), false},
+		{"daytime wrong day", daytime, at(16, 3, 0), false},
+		{"overnight before midnight", overnight, at(16, 23, 0), true},
+		{"overnight after midnight counts as the start day", overnight, at(17, 1, 30), true},
+		{"overnight end is exclusive", overnight, at(17, 2, 0), false},
+		{"overnight after midnight of a day not listed", overnight, at(16, 1, 0), false},
+		{"overnight before the start", overnight, at(16, 21, 59), false},
+		{"overnight start on a day not listed", overnight, at(17, 23, 0), false},
+		{"time zone", config.MaintenanceWindow{Start: "02:00", End: "06:00", TimeZone: "Asia/Tokyo"}, at(16, 18, 0), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := inWindow(tt.window, tt.now); got != tt.want {
+				t.Errorf("inWindow(%+v, %s) = %v, want %v", tt.window, tt.now, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSettled(t *testing.T) {
+	workload := func(kind string, generation int64, spec, status map[string]interface{}) unstructured.Unstructured {
+		w := unstructured.Unstructured{Object: map[string]interface{}{"kind": kind, "spec": spec, "status": status}}
+		w.SetGeneration(generation)
+		return w
+	}
+	tests := []struct {
+		name     string
+		workload unstructured.Unstructured
+		want     bool
+	}{
+		{"ready deployment", workload("Deployment", 2,
+			map[string]interface{}{"replicas": int64(3)},
+			map[string]interface{}{"observedGeneration": int64(2), "readyReplicas": int64(3), "updatedReplicas": int64(3)}), true},
+		{"rollout not observed", workload("Deployment", 3,
+			map[string]interface{}{"replicas": int64(3)},
+			map[string]interface{}{"observedGeneration": int64(2), "readyReplicas": int64(3), "updatedReplicas": int64(3)}), false},
+		{"pods not ready", workload("Deployment", 2,
+			map[string]interface{}{"replicas": int64(3)},
+			map[string]interface{}{"observedGeneration": int64(2), "readyReplicas": int64(2), "updatedReplicas": int64(3)}), false},
+		{"rollout in progress", workload("StatefulSet", 2,
+			map[string]interface{}{"replicas": int64(3)},
+			map[string]interface{}{"observedGeneration": int64(2), "readyReplicas": int64(3), "updatedReplicas": int64(1)}), false},
+		{"replicas default to 1", workload("Deployment", 1,
+			map[string]interface{}{},
+			map[string]interface{}{"observedGeneration": int64(1), "readyReplicas": int64(1), "updatedReplicas": int64(1)}), true},
+		{"ready daemonset", workload("DaemonSet", 1, map[string]interface{}{},
+			map[string]interface{}{"observedGeneration": int64(1), "desiredNumberScheduled": int64(4), "numberReady": int64(4), "updatedNumberScheduled": int64(4)}), true},
+		{"daemonset not updated", workload("DaemonSet", 1, map[string]interface{}{},
+			map[string]interface{}{"observedGeneration": int64(1), "desiredNumberScheduled": int64(4), "numberReady": int64(4), "updatedNumberScheduled": int64(3)}), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := settled(tt.workload); got != tt.want {
+				t.Errorf("settled() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDisruptionBlocked(t *testing.T) {
+	workload := unstructured.Unstructured{Object: map[string]interface{}{
+		"kind":     "Deployment",
+		"metadata": map[string]interface{}{"name": "api", "namespace": "app"},
+		"spec": map[string]interface{}{"template": map[string]interface{}{
+			"metadata": map[string]interface{}{"labels": map[string]interface{}{"app": "api"}},
+		}},
+	}}
+	pdb := func(namespace string, matchLabels map[string]string, allowed int32) *policyv1.PodDisruptionBudget {
+		return &policyv1.PodDisruptionBudget{
+			ObjectMeta: metav1.ObjectMeta{Name: "pdb", Namespace: namespace},
+			Spec:       policyv1.PodDisruptionBudgetSpec{Selector: &metav1.LabelSelector{MatchLabels: matchLabels}},
+			Status:     policyv1.PodDisruptionBudgetStatus{DisruptionsAllowed: allowed},
+		}
+	}
+	tests := []struct {
+		name string
+		pdbs []*policyv1.PodDisruptionBudget
+		want bool
+	}{
+		{"no budget", nil, false},
+		{"budget with disruptions left", []*policyv1.PodDisruptionBudget{pdb("app", map[string]string{"app": "api"}, 1)}, false},
+		{"budget exhausted", []*policyv1.PodDisruptionBudget{pdb("app", map[string]string{"app": "api"}, 0)}, true},
+		{"empty selector matches every pod", []*policyv1.PodDisruptionBudget{pdb("app", nil, 0)}, true},
+		{"budget of other pods", []*policyv1.PodDisruptionBudget{pdb("app", map[string]string{"app": "web"}, 0)}, false},
+		{"budget in another namespace", []*policyv1.PodDisruptionBudget{pdb("other", map[string]string{"app": "api"}, 0)}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewClientset()
+			for _, p := range tt.pdbs {
+				if _, err := client.PolicyV1().PodDisruptionBudgets(p.Namespace).Create(context.Background(), p, metav1.CreateOptions{}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, err := disruptionBlocked(context.Background(), client, workload)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("disruptionBlocked() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
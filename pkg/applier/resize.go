@@ -0,0 +1,256 @@
+package applier
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// resizeTimeout is how long the kubelets get to act on all of a workload's resizes. A resize
+// still pending after that (e.g. Deferred until resources free up) is left to the kubelet.
+const resizeTimeout = 20 * time.Second
+
+// podResize is one pod's resize and the patch that reverts it
+type podResize struct {
+	name            string
+	forward, revert []byte
+}
+
+// resizePods resizes the running pods of workload in place to containers (the strategic-merge
+// entries from plan). Resources whose resizePolicy requires a container restart, or that already
+// have the new value, are left alone. If a kubelet reports a resize Infeasible, every pod is reverted and ReasonResizeInfeasible
+// returned. Returns the number of pods resized.
+func resizePods(ctx context.Context, clients Clients, workload unstructured.Unstructured, containers []interface{}) (int, string, error) {
+	// 1. Running pods of the workload
+	selectorMap, _, _ := unstructured.NestedMap(workload.Object, "spec", "selector")
+	var labelSelector metav1.LabelSelector
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(selectorMap, &labelSelector); err != nil {
+		return 0, ReasonResizeFailed, fmt.Errorf("invalid selector: %v", err)
+	}
+	selector, err := metav1.LabelSelectorAsSelector(&labelSelector)
+	if err != nil {
+		return 0, ReasonResizeFailed, fmt.Errorf("invalid selector: %v", err)
+	}
+	if selector.Empty() {
+		return 0, ReasonResizeFailed, fmt.Errorf("workload has no pod selector")
+	}
+	podClient := clients.Core.CoreV1().Pods(workload.GetNamespace())
+	pods, err := podClient.List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return 0, ReasonResizeFailed, fmt.Errorf("failed to list pods: %v", err)
+	}
+
+	var resizes []podResize
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.Status.Phase != corev1.PodRunning || pod.DeletionTimestamp != nil {
+			continue
+		}
+		if r, ok := resizeOf(pod, containers); ok {
+			resizes = append(resizes, r)
+		}
+	}
+	if len(resizes) == 0 {
+		return 0, "", nil
+	}
+
+	// 2. Dry run every resize before changing any pod
+	dryRun := metav1.PatchOptions{FieldManager: FieldManager, DryRun: []string{metav1.DryRunAll}}
+	for _, r := range resizes {
+		if _, err := podClient.Patch(ctx, r.name, types.StrategicMergePatchType, r.forward, dryRun, "resize"); err != nil {
+			return 0, ReasonResizeFailed, fmt.Errorf("dry run of resizing pod %s failed: %v", r.name, err)
+		}
+	}
+
+	// 3. Resize
+	var done []podResize
+	for _, r := range resizes {
+		if _, err := podClient.Patch(ctx, r.name, types.StrategicMergePatchType, r.forward, metav1.PatchOptions{FieldManager: FieldManager}, "resize"); err != nil {
+			return 0, ReasonResizeFailed, errors.Join(fmt.Errorf("failed to resize pod %s: %v", r.name, err), revert(ctx, clients, workload, done))
+		}
+		done = append(done, r)
+	}
+
+	// 4. Roll everything back if a kubelet cannot fit the new resources
+	infeasible, err := waitForResizes(ctx, podClient, selector.String(), done)
+	if err != nil {
+		return len(done), ReasonResizeFailed, err
+	}
+	if infeasible != "" {
+		recordEvent(clients, &workload, corev1.EventTypeWarning, ReasonResizeInfeasible,
+			"In-place resize of pod %s is infeasible on its node; reverted %d pod(s)", infeasible, len(done))
+		return 0, ReasonResizeInfeasible, revert(ctx, clients, workload, done)
+	}
+	return len(done), "", nil
+}
+
+// resizeOf returns the resize of pod to containers, skipping resources whose resizePolicy restarts the container.
+// Returns false if there is nothing to resize in place.
+func resizeOf(pod *corev1.Pod, containers []interface{}) (podResize, bool) {
+	var forward, backward []interface{}
+	for _, entry := range containers {
+		target := entry.(map[string]interface{})
+		for _, c := range pod.Spec.Containers {
+			if c.Name != target["name"] {
+				continue
+			}
+			restart := map[corev1.ResourceName]bool{}
+			for _, p := range c.ResizePolicy {
+				restart[p.ResourceName] = p.RestartPolicy == corev1.RestartContainer
+			}
+
+			newResources, oldResources := map[string]interface{}{}, map[string]interface{}{}
+			for kind, values := range target["resources"].(map[string]interface{}) {
+				current := c.Resources.Requests
+				if kind == "limits" {
+					current = c.Resources.Limits
+				}
+				next, old := map[string]interface{}{}, map[string]interface{}{}
+				for name, value := range values.(map[string]interface{}) {
+					q, ok := current[corev1.ResourceName(name)]
+					if !ok || restart[corev1.ResourceName(name)] {
+						continue
+					}
+					if v, err := resource.ParseQuantity(value.(string)); err == nil && v.Cmp(q) == 0 {
+						continue // Already resized
+					}
+					next[name], old[name] = value, q.String()
+				}
+				if len(next) > 0 {
+					newResources[kind], oldResources[kind] = next, old
+				}
+			}
+			if len(newResources) > 0 {
+				forward = append(forward, map[string]interface{}{"name": c.Name, "resources": newResources})
+				backward = append(backward, map[string]interface{}{"name": c.Name, "resources": oldResources})
+			}
+		}
+	}
+	if len(forward) == 0 {
+		return podResize{}, false
+	}
+	patch := func(containers []interface{}) []byte {
+		data, _ := json.Marshal(map[string]interface{}{"spec": map[string]interface{}{"containers": containers}})
+		return data
+	}
+	return podResize{name: pod.Name, forward: patch(forward), revert: patch(backward)}, true
+}
+
+// waitForResizes waits, with one listing per poll and a shared resizeTimeout, until the kubelets have
+// applied every resize done or one reports it infeasible. Returns the name of an infeasible pod, or "".
+// Pods that are gone count as done.
+func waitForResizes(ctx context.Context, podClient corev1client.PodInterface, selector string, done []podResize) (string, error) {
+	pending := make(map[string]bool, len(done))
+	for _, r := range done {
+		pending[r.name] = true
+	}
+	infeasible := ""
+	err := wait.PollUntilContextTimeout(ctx, time.Second, resizeTimeout, true, func(ctx context.Context) (bool, error) {
+		pods, err := podClient.List(ctx, metav1.ListOptions{LabelSelector: selector})
+		if err != nil {
+			return false, err
+		}
+		listed := make(map[string]bool, len(pods.Items))
+		for i := range pods.Items {
+			pod := &pods.Items[i]
+			if !pending[pod.Name] {
+				continue
+			}
+			listed[pod.Name] = true
+			state := resizeState(pod)
+			if state == resizeInfeasible {
+				infeasible = pod.Name
+				return true, nil
+			}
+			if state == resizeDone {
+				delete(pending, pod.Name)
+			}
+		}
+		for name := range pending {
+			if !listed[name] {
+				delete(pending, name)
+			}
+		}
+		return len(pending) == 0, nil
+	})
+	if wait.Interrupted(err) && ctx.Err() == nil {
+		return "", nil // Still pending: left to the kubelet
+	}
+	return infeasible, err
+}
+
+// States of a pod's resize
+const (
+	resizePending = iota
+	resizeDone
+	resizeInfeasible
+)
+
+// resizeState returns the state of a pod's last resize
+func resizeState(pod *corev1.Pod) int {
+	// Before Kubernetes 1.33 the state is in status.resize instead of the conditions
+	pending := pod.Status.Resize != ""
+	infeasible := pod.Status.Resize == corev1.PodResizeStatusInfeasible
+	for _, c := range pod.Status.Conditions {
+		switch c.Type {
+		case corev1.PodResizePending:
+			pending = true
+			infeasible = infeasible || c.Reason == corev1.PodReasonInfeasible
+		case corev1.PodResizeInProgress:
+			pending = true
+		}
+	}
+	switch {
+	case infeasible:
+		return resizeInfeasible
+	case !pending && resizeApplied(pod):
+		return resizeDone
+	}
+	return resizePending
+}
+
+// resizeApplied reports whether the running containers have the resources of the pod spec.
+// Kubelets that do not report container resources count as applied.
+func resizeApplied(pod *corev1.Pod) bool {
+	for _, c := range pod.Spec.Containers {
+		for _, s := range pod.Status.ContainerStatuses {
+			if s.Name != c.Name || s.Resources == nil {
+				continue
+			}
+			for name, q := range c.Resources.Requests {
+				if actual, ok := s.Resources.Requests[name]; ok && actual.Cmp(q) != 0 {
+					return false
+				}
+			}
+			for name, q := range c.Resources.Limits {
+				if actual, ok := s.Resources.Limits[name]; ok && actual.Cmp(q) != 0 {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+// revert undoes the resizes done
+func revert(ctx context.Context, clients Clients, workload unstructured.Unstructured, done []podResize) error {
+	var errs []error
+	for _, r := range done {
+		_, err := clients.Core.CoreV1().Pods(workload.GetNamespace()).Patch(ctx, r.name, types.StrategicMergePatchType, r.revert, metav1.PatchOptions{FieldManager: FieldManager}, "resize")
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to revert resize of pod %s: %v", r.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
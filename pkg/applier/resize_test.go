@@ -0,0 +1,254 @@
+package applier
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// testPod returns a running pod of app "api" with one container "api" requesting cpu and memory
+func testPod(name, cpu, memory string, conditions ...corev1.PodCondition) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "shop", Labels: map[string]string{"app": "api"}},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{{
+			Name: "api",
+			Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse(cpu),
+				corev1.ResourceMemory: resource.MustParse(memory),
+			}},
+		}}},
+		Status: corev1.PodStatus{Phase: corev1.PodRunning, Conditions: conditions},
+	}
+}
+
+// testWorkload returns a Deployment selecting app "api"
+func testWorkload() unstructured.Unstructured {
+	w := unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{
+			"selector": map[string]interface{}{"matchLabels": map[string]interface{}{"app": "api"}},
+		},
+	}}
+	w.SetKind("Deployment")
+	w.SetNamespace("shop")
+	w.SetName("api")
+	return w
+}
+
+// target is the plan entry setting container "api" to 500m and 256Mi
+var target = []interface{}{map[string]interface{}{
+	"name": "api",
+	"resources": map[string]interface{}{
+		"requests": map[string]interface{}{"cpu": "500m", "memory": "256Mi"},
+	},
+}}
+
+func TestResizeOf(t *testing.T) {
+	restartMemory := testPod("api-1", "1", "512Mi")
+	restartMemory.Spec.Containers[0].ResizePolicy = []corev1.ContainerResizePolicy{
+		{ResourceName: corev1.ResourceMemory, RestartPolicy: corev1.RestartContainer},
+	}
+	noMemory := testPod("api-1", "1", "512Mi")
+	delete(noMemory.Spec.Containers[0].Resources.Requests, corev1.ResourceMemory)
+
+	tests := []struct {
+		name                    string
+		pod                     *corev1.Pod
+		wantForward, wantRevert map[string]interface{}
+	}{
+		{
+			name:        "requests are resized",
+			pod:         testPod("api-1", "1", "512Mi"),
+			wantForward: map[string]interface{}{"cpu": "500m", "memory": "256Mi"},
+			wantRevert:  map[string]interface{}{"cpu": "1", "memory": "512Mi"},
+		},
+		{
+			name:        "resources that restart the container are left alone",
+			pod:         restartMemory,
+			wantForward: map[string]interface{}{"cpu": "500m"},
+			wantRevert:  map[string]interface{}{"cpu": "1"},
+		},
+		{
+			name:        "resources the pod does not set are left alone",
+			pod:         noMemory,
+			wantForward: map[string]interface{}{"cpu": "500m"},
+			wantRevert:  map[string]interface{}{"cpu": "1"},
+		},
+		{
+			name:        "resources already resized are left alone",
+			pod:         testPod("api-1", "500m", "512Mi"),
+			wantForward: map[string]interface{}{"memory": "256Mi"},
+			wantRevert:  map[string]interface{}{"memory": "512Mi"},
+		},
+		{
+			name: "nothing to resize",
+			pod:  testPod("api-1", "500m", "256Mi"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, ok := resizeOf(tt.pod, target)
+			if ok != (tt.wantForward != nil) {
+				t.Fatalf("resizeOf() ok = %v, want %v", ok, tt.wantForward != nil)
+			}
+			if !ok {
+				return
+			}
+			requests := func(patch []byte) map[string]interface{} {
+				var p map[string]interface{}
+				if err := json.Unmarshal(patch, &p); err != nil {
+					t.Fatal(err)
+				}
+				containers, _, _ := unstructured.NestedSlice(p, "spec", "containers")
+				got, _, _ := unstructured.NestedMap(containers[0].(map[string]interface{}), "resources", "requests")
+				return got
+			}
+			if got := requests(r.forward); !reflect.DeepEqual(got, tt.wantForward) {
+				t.Errorf("forward requests = %v, want %v", got, tt.wantForward)
+			}
+			if got := requests(r.revert); !reflect.DeepEqual(got, tt.wantRevert) {
+				t.Errorf("revert requests = %v, want %v", got, tt.wantRevert)
+			}
+		})
+	}
+}
+
+func TestResizeState(t *testing.T) {
+	withStatus := func(pod *corev1.Pod, status corev1.ContainerStatus) *corev1.Pod {
+		status.Name = "api"
+		pod.Status.ContainerStatuses = []corev1.ContainerStatus{status}
+		return pod
+	}
+	actual := func(cpu, memory string) corev1.ContainerStatus {
+		return corev1.ContainerStatus{Resources: &corev1.ResourceRequirements{Requests: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse(cpu),
+			corev1.ResourceMemory: resource.MustParse(memory),
+		}}}
+	}
+	legacyInfeasible := testPod("api-1", "1", "1Gi")
+	legacyInfeasible.Status.Resize = corev1.PodResizeStatusInfeasible
+
+	tests := []struct {
+		name string
+		pod  *corev1.Pod
+		want int
+	}{
+		{"applied", withStatus(testPod("api-1", "1", "1Gi"), actual("1", "1Gi")), resizeDone},
+		{"kubelet reports no resources", testPod("api-1", "1", "1Gi"), resizeDone},
+		{"not applied yet", withStatus(testPod("api-1", "1", "1Gi"), actual("2", "1Gi")), resizePending},
+		{"in progress", testPod("api-1", "1", "1Gi", corev1.PodCondition{Type: corev1.PodResizeInProgress, Status: corev1.ConditionTrue}), resizePending},
+		{"deferred", testPod("api-1", "1", "1Gi", corev1.PodCondition{Type: corev1.PodResizePending, Status: corev1.ConditionTrue, Reason: corev1.PodReasonDeferred}), resizePending},
+		{"infeasible", testPod("api-1", "1", "1Gi", corev1.PodCondition{Type: corev1.PodResizePending, Status: corev1.ConditionTrue, Reason: corev1.PodReasonInfeasible}), resizeInfeasible},
+		{"infeasible before Kubernetes 1.33", legacyInfeasible, resizeInfeasible},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resizeState(tt.pod); got != tt.want {
+				t.Errorf("resizeState() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResizePods(t *testing.T) {
+	infeasible := corev1.PodCondition{Type: corev1.PodResizePending, Status: corev1.ConditionTrue, Reason: corev1.PodReasonInfeasible}
+	pending := testPod("api-3", "1", "512Mi")
+	pending.Status.Phase = corev1.PodPending
+
+	tests := []struct {
+		name        string
+		pods        []*corev1.Pod
+		wantResized int
+		wantReason  string
+		wantCPU     map[string]string // Per pod, after resizePods
+	}{
+		{
+			name:        "running pods are resized",
+			pods:        []*corev1.Pod{testPod("api-1", "1", "512Mi"), testPod("api-2", "1", "512Mi"), pending},
+			wantResized: 2,
+			wantCPU:     map[string]string{"api-1": "500m", "api-2": "500m", "api-3": "1"},
+		},
+		{
+			name:    "already resized pods are skipped",
+			pods:    []*corev1.Pod{testPod("api-1", "500m", "256Mi")},
+			wantCPU: map[string]string{"api-1": "500m"},
+		},
+		{
+			name:       "an infeasible resize reverts every pod",
+			pods:       []*corev1.Pod{testPod("api-1", "1", "512Mi"), testPod("api-2", "1", "512Mi", infeasible)},
+			wantReason: ReasonResizeInfeasible,
+			wantCPU:    map[string]string{"api-1": "1", "api-2": "1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			core := fake.NewClientset()
+			for _, pod := range tt.pods {
+				if _, err := core.CoreV1().Pods("shop").Create(context.Background(), pod, metav1.CreateOptions{}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			resized, reason, err := resizePods(context.Background(), Clients{Core: core}, testWorkload(), target)
+			if err != nil {
+				t.Fatalf("resizePods() error = %v", err)
+			}
+			if resized != tt.wantResized || reason != tt.wantReason {
+				t.Errorf("resizePods() = %d, %q; want %d, %q", resized, reason, tt.wantResized, tt.wantReason)
+			}
+			for name, want := range tt.wantCPU {
+				pod, err := core.CoreV1().Pods("shop").Get(context.Background(), name, metav1.GetOptions{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := pod.Spec.Containers[0].Resources.Requests.Cpu(); got.Cmp(resource.MustParse(want)) != 0 {
+					t.Errorf("pod %s CPU request = %s, want %s", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestWaitForResizesGonePods(t *testing.T) {
+	core := fake.NewClientset(testPod("api-1", "1", "512Mi"))
+	done := []podResize{{name: "api-1"}, {name: "api-deleted"}}
+	infeasible, err := waitForResizes(context.Background(), core.CoreV1().Pods("shop"), "app=api", done)
+	if infeasible != "" || err != nil {
+		t.Errorf("waitForResizes() = %q, %v; want no infeasible pod", infeasible, err)
+	}
+}
+
+func TestRollsOut(t *testing.T) {
+	workload := func(kind, strategy string) unstructured.Unstructured {
+		w := unstructured.Unstructured{Object: map[string]interface{}{"spec": map[string]interface{}{}}}
+		w.SetKind(kind)
+		if strategy != "" {
+			_ = unstructured.SetNestedField(w.Object, strategy, "spec", "updateStrategy", "type")
+		}
+		return w
+	}
+	tests := []struct {
+		name     string
+		workload unstructured.Unstructured
+		want     bool
+	}{
+		{"Deployment", workload("Deployment", ""), true},
+		{"StatefulSet defaults to RollingUpdate", workload("StatefulSet", ""), true},
+		{"RollingUpdate DaemonSet", workload("DaemonSet", "RollingUpdate"), true},
+		{"OnDelete StatefulSet", workload("StatefulSet", "OnDelete"), false},
+		{"OnDelete DaemonSet", workload("DaemonSet", "OnDelete"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rollsOut(tt.workload); got != tt.want {
+				t.Errorf("rollsOut() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
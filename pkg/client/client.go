@@ -2,23 +2,51 @@ package client
 
 import (
 	"fmt"
-	"os"
-	"path/filepath"
 
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
-	"k8s.io/client-go/util/homedir"
+	"k8s.io/client-go/util/flowcontrol"
 )
 
+// Options controls how Connect builds the client configuration
+type Options struct {
+	// Kubeconfig is an explicit kubeconfig path. Empty uses the standard
+	// loading rules (KUBECONFIG, then ~/.kube/config).
+	Kubeconfig string
+	// Context selects a kubeconfig context instead of the current one
+	Context string
+
+	// Client-side token bucket shared by both clients, so concurrent workers
+	// cannot exceed the configured API-server budget together.
+	QPS   float32
+	Burst int
+
+	// ImpersonateUser/ImpersonateGroups make every request as another identity,
+	// e.g. to see which suggestions a team's RBAC allows.
+	ImpersonateUser   string
+	ImpersonateGroups []string
+}
+
 // Connect returns a dynamic client interface and a core clientset.
-func Connect() (dynamic.Interface, *kubernetes.Clientset, error) {
-	config, err := getClientConfig()
+func Connect(opts Options) (dynamic.Interface, *kubernetes.Clientset, error) {
+	config, err := getClientConfig(opts)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to get k8s config: %w", err)
 	}
 
+	config.QPS = opts.QPS
+	config.Burst = opts.Burst
+	config.RateLimiter = flowcontrol.NewTokenBucketRateLimiter(opts.QPS, opts.Burst)
+
+	if opts.ImpersonateUser != "" || len(opts.ImpersonateGroups) > 0 {
+		config.Impersonate = rest.ImpersonationConfig{
+			UserName: opts.ImpersonateUser,
+			Groups:   opts.ImpersonateGroups,
+		}
+	}
+
 	// Dynamic Client is used for Custom Resources (CRDs)
 	dynClient, err := dynamic.NewForConfig(config)
 	if err != nil {
@@ -34,23 +62,22 @@ func Connect() (dynamic.Interface, *kubernetes.Clientset, error) {
 	return dynClient, coreClient, nil
 }
 
-// getClientConfig tries InClusterConfig first, then falls back to ~/.kube/config
-func getClientConfig() (*rest.Config, error) {
+// getClientConfig tries InClusterConfig first, then falls back to the standard kubeconfig loading rules.
+// An explicit kubeconfig or context always wins over the in-cluster config.
+func getClientConfig(opts Options) (*rest.Config, error) {
 	// 1. Try In-Cluster Config (works when running inside a Pod)
-	config, err := rest.InClusterConfig()
-	if err == nil {
-		return config, nil
+	if opts.Kubeconfig == "" && opts.Context == "" {
+		if config, err := rest.InClusterConfig(); err == nil {
+			return config, nil
+		}
 	}
 
 	// 2. Fallback to Local Kubeconfig (works on your laptop)
-	kubeconfigPath := os.Getenv("KUBECONFIG")
-	if kubeconfigPath == "" {
-		if home := homedir.HomeDir(); home != "" {
-			kubeconfigPath = filepath.Join(home, ".kube", "config-kind")
-		}
-	}
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = opts.Kubeconfig
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: opts.Context}
 
-	config, err = clientcmd.BuildConfigFromFlags("", kubeconfigPath)
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides).ClientConfig()
 	if err != nil {
 		return nil, fmt.Errorf("could not load in-cluster config or local kubeconfig: %w", err)
 	}
@@ -0,0 +1,105 @@
+package cluster
+
+import (
+	"fmt"
+	"log/slog"
+
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/joe-l-mathew/kube-resource-suggest/pkg/client"
+	"github.com/joe-l-mathew/kube-resource-suggest/pkg/config"
+	"github.com/joe-l-mathew/kube-resource-suggest/pkg/engine"
+	"github.com/joe-l-mathew/kube-resource-suggest/pkg/reporter"
+)
+
+// Cluster is one scanned cluster: where workloads are read from and where their suggestions go
+type Cluster struct {
+	// Name labels suggestions, metrics and logs; empty in single-cluster mode
+	Name       string
+	Client     dynamic.Interface
+	CoreClient *kubernetes.Clientset
+
+	// Writer receives the ResourceSuggestions: the cluster itself or the hub
+	Writer dynamic.Interface
+	Target reporter.Target
+}
+
+// Prometheus returns this cluster's Prometheus endpoint from the active configuration
+func (c *Cluster) Prometheus() engine.PrometheusTarget {
+	target := engine.GetPrometheusTarget()
+	for _, cl := range config.Get().Clusters {
+		if cl.Name != c.Name {
+			continue
+		}
+		if cl.Prometheus.URL != "" {
+			target.URL = cl.Prometheus.URL
+		}
+		if cl.Prometheus.Tenant != "" {
+			target.Tenant = cl.Prometheus.Tenant
+		}
+	}
+	return target
+}
+
+// Logger returns the default logger, tagged with the cluster name in multi-cluster mode
+func (c *Cluster) Logger() *slog.Logger {
+	if c.Name == "" {
+		return slog.Default()
+	}
+	return slog.With("cluster", c.Name)
+}
+
+// Build connects to the configured clusters and the hub. Without a cluster list
+// the local cluster is scanned alone. Entries without kubeconfig or context reuse
+// the local clients. A cluster that cannot be connected is logged and skipped.
+func Build(cfg *config.Config, base client.Options, local dynamic.Interface, localCore *kubernetes.Clientset) ([]*Cluster, error) {
+	// 1. Single-cluster mode
+	if len(cfg.Clusters) == 0 {
+		return []*Cluster{{Client: local, CoreClient: localCore, Writer: local}}, nil
+	}
+
+	// 2. Hub
+	var hub dynamic.Interface
+	if cfg.Hub.Enabled {
+		hub = local
+		if cfg.Hub.Kubeconfig != "" || cfg.Hub.Context != "" {
+			opts := base
+			opts.Kubeconfig, opts.Context = cfg.Hub.Kubeconfig, cfg.Hub.Context
+			dyn, _, err := client.Connect(opts)
+			if err != nil {
+				return nil, fmt.Errorf("failed to connect to hub: %w", err)
+			}
+			hub = dyn
+		}
+	}
+
+	// 3. Clusters
+	var clusters []*Cluster
+	for _, cc := range cfg.Clusters {
+		c := &Cluster{Name: cc.Name, Client: local, CoreClient: localCore, Target: reporter.Target{Cluster: cc.Name}}
+
+		if cc.Kubeconfig != "" || cc.Context != "" {
+			opts := base
+			opts.Kubeconfig, opts.Context = cc.Kubeconfig, cc.Context
+			dyn, core, err := client.Connect(opts)
+			if err != nil {
+				slog.Error("Failed to connect to cluster, skipping it", "cluster", cc.Name, "error", err)
+				continue
+			}
+			c.Client, c.CoreClient = dyn, core
+		}
+
+		c.Writer = c.Client
+		if hub != nil {
+			c.Writer = hub
+			c.Target.HubNamespace = cfg.Hub.Namespace
+		}
+		clusters = append(clusters, c)
+	}
+
+	if len(clusters) == 0 {
+		return nil, fmt.Errorf("none of the %d configured clusters could be connected", len(cfg.Clusters))
+	}
+	return clusters, nil
+}
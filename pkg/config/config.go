@@ -0,0 +1,615 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/yaml"
+
+	"github.com/joe-l-mathew/kube-resource-suggest/pkg/logging"
+)
+
+// Config is the controller configuration, loaded from a YAML file with environment variable overrides.
+// Settings marked "restart" are only read at startup; everything else applies on the next scan.
+type Config struct {
+	ScanInterval        Duration `json:"scanInterval"`
+	Workers             int      `json:"workers"`
+	WorkloadTimeout     Duration `json:"workloadTimeout"`
+	ShutdownGracePeriod Duration `json:"shutdownGracePeriod"`
+	IgnoredNamespaces   []string `json:"ignoredNamespaces"`
+	// WatchNamespaces limits scanning to these namespaces (namespace-scoped mode, Role-level RBAC)
+	WatchNamespaces []string `json:"watchNamespaces,omitempty"`
+	// Fallback is the source used when Prometheus has no data: kubelet, metrics-server or none.
+	// Empty picks kubelet, or metrics-server in namespace-scoped mode.
+	Fallback string `json:"fallback,omitempty"`
+	// MemoryMetric is workingset, rss or cacheaware
+	MemoryMetric string `json:"memoryMetric"`
+	// GarbageCollection handles suggestions for removed containers and workloads: delete, mark or off
+	GarbageCollection string `json:"garbageCollection"`
+
+	Logging        LoggingConfig        `json:"logging"`
+	API            APIConfig            `json:"api"`
+	Prometheus     PrometheusConfig     `json:"prometheus"`
+	Recommendation RecommendationConfig `json:"recommendation"`
+	History        HistoryConfig        `json:"history"`
+	Reports        ReportsConfig        `json:"reports"`
+	AutoApply      AutoApplyConfig      `json:"autoApply"`
+	Webhook        WebhookConfig        `json:"webhook"`
+	HTTP           HTTPConfig           `json:"http"`
+	Health         HealthConfig         `json:"health"`
+	LeaderElection LeaderElectionConfig `json:"leaderElection"`
+
+	// Clusters to scan from this controller (restart). Empty scans only the local cluster.
+	Clusters []ClusterConfig `json:"clusters,omitempty"`
+	// Hub, when enabled, receives the suggestions of every cluster (restart)
+	Hub HubConfig `json:"hub"`
+}
+
+type LoggingConfig struct {
+	Level string `json:"level"`
+	// Format is text or json (restart)
+	Format string `json:"format"`
+	// AllowLevelChange lets PUT /loglevel change the level; /loglevel is read-only otherwise
+	AllowLevelChange bool `json:"allowLevelChange"`
+}
+
+// APIConfig is the API-server connection: token bucket, kubeconfig context and impersonation (restart)
+type APIConfig struct {
+	QPS   float64 `json:"qps"`
+	Burst int     `json:"burst"`
+	// Context selects a kubeconfig context when running outside the cluster
+	Context     string            `json:"context,omitempty"`
+	Impersonate ImpersonateConfig `json:"impersonate"`
+}
+
+// ImpersonateConfig makes all API requests as another user and/or groups
+type ImpersonateConfig struct {
+	User   string   `json:"user,omitempty"`
+	Groups []string `json:"groups,omitempty"`
+}
+
+type PrometheusConfig struct {
+	URL string `json:"url"`
+	// Tenant is sent as X-Scope-OrgID for multi-tenant backends (Thanos, Cortex, Mimir)
+	Tenant    string           `json:"tenant,omitempty"`
+	Timeout   Duration         `json:"timeout"`
+	QPS       float64          `json:"qps"`
+	Burst     int              `json:"burst"`
+	OpenShift bool             `json:"openshift"`
+	Schema    PrometheusSchema `json:"schema"`
+}
+
+// PrometheusSchema maps metric and label names for non-standard setups
+type PrometheusSchema struct {
+	CpuMetric          string `json:"cpuMetric"`
+	MemoryMetric       string `json:"memoryMetric"`
+	RssMetric          string `json:"rssMetric"`
+	UsageMetric        string `json:"usageMetric"`
+	InactiveFileMetric string `json:"inactiveFileMetric"`
+	NamespaceLabel     string `json:"namespaceLabel"`
+	PodLabel           string `json:"podLabel"`
+	ContainerLabel     string `json:"containerLabel"`
+	CpuQuery           string `json:"cpuQuery,omitempty"`
+	MemoryQuery        string `json:"memoryQuery,omitempty"`
+}
+
+// RecommendationConfig holds the thresholds used to turn usage into recommendations
+type RecommendationConfig struct {
+	// Headroom multiplies peak usage, e.g. 1.2 for +20%
+	Headroom  float64           `json:"headroom"`
+	MinCpu    resource.Quantity `json:"minCpu"`
+	MinMemory resource.Quantity `json:"minMemory"`
+	// Hysteresis keeps the published recommendation through small or short-lived changes
+	Hysteresis HysteresisConfig `json:"hysteresis"`
+}
+
+// HysteresisConfig sets how much a recommendation must change before it is published.
+// A new value must differ by more than both the relative and the absolute threshold.
+type HysteresisConfig struct {
+	// Relative is the fraction of the previous value, e.g. 0.1 for 10%
+	Relative        float64           `json:"relative"`
+	MinCpuChange    resource.Quantity `json:"minCpuChange"`
+	MinMemoryChange resource.Quantity `json:"minMemoryChange"`
+	// MinStableTime is how long a new status must persist before it replaces the old one
+	MinStableTime Duration `json:"minStableTime"`
+}
+
+// AutoApplyConfig lets the controller patch workloads to their recommendation. Only workloads
+// annotated krs.io/auto-apply=true, or in a namespace annotated so, are changed.
+type AutoApplyConfig struct {
+	Enabled bool `json:"enabled"`
+	// Mode is template (patch the pod template) or inPlace (resize the running pods). In inPlace
+	// mode the template is only patched where that starts no rollout (OnDelete StatefulSets and
+	// DaemonSets), unless PatchRollingTemplates is set.
+	Mode string `json:"mode"`
+	// PatchRollingTemplates also patches, in inPlace mode, the template of workloads that roll out
+	// on a template change. The rollout replaces the pods that were just resized.
+	PatchRollingTemplates bool `json:"patchRollingTemplates"`
+	// MaxChange is the largest change per step, as a fraction of the current value
+	MaxChange float64 `json:"maxChange"`
+	// MinDataAge is how old a workload must be, so the usage history covers it
+	MinDataAge Duration `json:"minDataAge"`
+	// Cooldown is the minimum time between two changes of the same workload
+	Cooldown          Duration          `json:"cooldown"`
+	MaintenanceWindow MaintenanceWindow `json:"maintenanceWindow"`
+}
+
+// MaintenanceWindow is when workloads may be changed. Empty Start and End allow any time of day,
+// empty Days every day. A window whose End is before its Start runs past midnight.
+type MaintenanceWindow struct {
+	// Days are weekday abbreviations: Mon, Tue, Wed, Thu, Fri, Sat, Sun
+	Days []string `json:"days,omitempty"`
+	// Start and End are "15:04" in TimeZone
+	Start    string `json:"start,omitempty"`
+	End      string `json:"end,omitempty"`
+	TimeZone string `json:"timeZone,omitempty"`
+}
+
+// TimeOfDay is the layout of MaintenanceWindow Start and End
+const TimeOfDay = "15:04"
+
+// Weekdays maps the MaintenanceWindow day abbreviations
+var Weekdays = map[string]time.Weekday{
+	"Sun": time.Sunday, "Mon": time.Monday, "Tue": time.Tuesday, "Wed": time.Wednesday,
+	"Thu": time.Thursday, "Fri": time.Friday, "Sat": time.Saturday,
+}
+
+// WebhookConfig is the mutating admission webhook that sets the recommended resources on new pods
+// of namespaces labelled krs.io/inject-resources=true (restart)
+type WebhookConfig struct {
+	Enabled bool `json:"enabled"`
+	// Addr is the HTTPS listen address
+	Addr string `json:"addr"`
+	// CertDir holds tls.crt and tls.key; they are reloaded when they change
+	CertDir string `json:"certDir"`
+	// Timeout bounds the suggestion lookup of one admission request; pods are admitted unchanged after it
+	Timeout Duration `json:"timeout"`
+	// QPS and Burst are the webhook's own API token bucket, so pod creation bursts
+	// cannot starve the scan loop's writes, nor a long scan the admissions
+	QPS   float64 `json:"qps"`
+	Burst int     `json:"burst"`
+}
+
+// ReportsConfig controls the ResourceSuggestionReport roll-ups written after each complete scan
+type ReportsConfig struct {
+	Enabled bool `json:"enabled"`
+	// TopN is the number of most over-provisioned workloads listed in each report
+	TopN int `json:"topN"`
+}
+
+// HistoryConfig bounds the recommendation history kept in each suggestion's status
+type HistoryConfig struct {
+	// MaxEntries is the number of changes kept; 0 disables the history
+	MaxEntries int `json:"maxEntries"`
+	// MaxAge drops older entries; 0 keeps them until MaxEntries is reached
+	MaxAge Duration `json:"maxAge"`
+}
+
+// HTTPConfig is the probe/metrics server (restart)
+type HTTPConfig struct {
+	Addr  string `json:"addr"`
+	Pprof bool   `json:"pprof"`
+}
+
+type HealthConfig struct {
+	MaxMissedScans int `json:"maxMissedScans"`
+}
+
+// LeaderElectionConfig (restart)
+type LeaderElectionConfig struct {
+	Enabled   bool   `json:"enabled"`
+	LeaseName string `json:"leaseName"`
+	Namespace string `json:"namespace"`
+}
+
+// ClusterConfig is one cluster scanned by this controller.
+// With neither kubeconfig nor context the controller's own cluster is used.
+type ClusterConfig struct {
+	Name       string `json:"name"`
+	Kubeconfig string `json:"kubeconfig,omitempty"`
+	Context    string `json:"context,omitempty"`
+	// Prometheus overrides prometheus.url/tenant for this cluster
+	Prometheus ClusterPrometheusConfig `json:"prometheus"`
+}
+
+type ClusterPrometheusConfig struct {
+	URL    string `json:"url,omitempty"`
+	Tenant string `json:"tenant,omitempty"`
+}
+
+// HubConfig is the cluster that collects suggestions from all clusters
+type HubConfig struct {
+	Enabled    bool   `json:"enabled"`
+	Kubeconfig string `json:"kubeconfig,omitempty"`
+	Context    string `json:"context,omitempty"`
+	// Namespace on the hub that receives all suggestions
+	Namespace string `json:"namespace"`
+}
+
+// Fallback sources used when Prometheus has no data
+const (
+	FallbackKubelet       = "kubelet"
+	FallbackMetricsServer = "metrics-server"
+	FallbackNone          = "none"
+)
+
+// Garbage collection modes for orphaned suggestions
+const (
+	GCDelete = "delete"
+	GCMark   = "mark"
+	GCOff    = "off"
+)
+
+// Auto-apply modes
+const (
+	ApplyTemplate = "template"
+	ApplyInPlace  = "inPlace"
+)
+
+// NamespaceScoped reports whether only watchNamespaces are scanned
+func (c *Config) NamespaceScoped() bool {
+	return len(c.WatchNamespaces) > 0
+}
+
+// FallbackSource resolves the fallback source, defaulting by mode
+func (c *Config) FallbackSource() string {
+	if c.Fallback != "" {
+		return c.Fallback
+	}
+	if c.NamespaceScoped() {
+		return FallbackMetricsServer
+	}
+	return FallbackKubelet
+}
+
+// Duration is a time.Duration that reads and writes as a string like "1h30m"
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"30s\": %w", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = v
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// Default returns the built-in configuration
+func Default() *Config {
+	return &Config{
+		ScanInterval:        Duration{time.Hour},
+		Workers:             4,
+		WorkloadTimeout:     Duration{2 * time.Minute},
+		ShutdownGracePeriod: Duration{20 * time.Second},
+		IgnoredNamespaces:   []string{"kube-system"},
+		MemoryMetric:        "workingset",
+		GarbageCollection:   GCDelete,
+		Logging:             LoggingConfig{Level: "info", Format: "text"},
+		API:                 APIConfig{QPS: 20, Burst: 40},
+		Prometheus: PrometheusConfig{
+			URL:     "http://krs-prometheus-svc:9090",
+			Timeout: Duration{10 * time.Second},
+			QPS:     10,
+			Burst:   20,
+			Schema: PrometheusSchema{
+				CpuMetric:          "container_cpu_usage_seconds_total",
+				MemoryMetric:       "container_memory_working_set_bytes",
+				RssMetric:          "container_memory_rss",
+				UsageMetric:        "container_memory_usage_bytes",
+				InactiveFileMetric: "container_memory_total_inactive_file_bytes",
+				NamespaceLabel:     "namespace",
+				PodLabel:           "pod",
+				ContainerLabel:     "container",
+			},
+		},
+		Recommendation: RecommendationConfig{
+			Headroom:  1.2,
+			MinCpu:    resource.MustParse("30m"),
+			MinMemory: resource.MustParse("50Mi"),
+			// Hysteresis is off unless configured, so upgrades publish changes as before
+			Hysteresis: HysteresisConfig{},
+		},
+		History: HistoryConfig{MaxEntries: 30, MaxAge: Duration{30 * 24 * time.Hour}},
+		Reports: ReportsConfig{Enabled: true, TopN: 10},
+		AutoApply: AutoApplyConfig{
+			Mode:              ApplyTemplate,
+			MaxChange:         0.5,
+			MinDataAge:        Duration{7 * 24 * time.Hour},
+			Cooldown:          Duration{24 * time.Hour},
+			MaintenanceWindow: MaintenanceWindow{TimeZone: "UTC"},
+		},
+		Webhook: WebhookConfig{
+			Addr:    ":9443",
+			CertDir: "/etc/krs-webhook/tls",
+			Timeout: Duration{2 * time.Second},
+			QPS:     20,
+			Burst:   40,
+		},
+		HTTP:   HTTPConfig{Addr: ":8080"},
+		Health: HealthConfig{MaxMissedScans: 3},
+		LeaderElection: LeaderElectionConfig{
+			LeaseName: "krs-controller-leader",
+		},
+	}
+}
+
+// Load reads the config file at path (if any) over the defaults, applies env overrides and validates the result
+func Load(path string) (*Config, error) {
+	cfg := Default()
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config file: %w", err)
+		}
+		if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+			return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+		}
+	}
+
+	if err := applyEnvOverrides(cfg); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Validate reports every invalid setting at once
+func (c *Config) Validate() error {
+	var problems []string
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+
+	check(c.ScanInterval.Duration > 0, "scanInterval must be positive")
+	check(c.Workers > 0, "workers must be at least 1")
+	check(c.WorkloadTimeout.Duration > 0, "workloadTimeout must be positive")
+	check(c.ShutdownGracePeriod.Duration > 0, "shutdownGracePeriod must be positive")
+
+	switch c.MemoryMetric {
+	case "workingset", "rss", "cacheaware":
+	default:
+		problems = append(problems, fmt.Sprintf("memoryMetric %q must be workingset, rss or cacheaware", c.MemoryMetric))
+	}
+
+	switch c.GarbageCollection {
+	case GCDelete, GCMark, GCOff:
+	default:
+		problems = append(problems, fmt.Sprintf("garbageCollection %q must be delete, mark or off", c.GarbageCollection))
+	}
+
+	switch c.Fallback {
+	case "", FallbackKubelet, FallbackMetricsServer, FallbackNone:
+	default:
+		problems = append(problems, fmt.Sprintf("fallback %q must be kubelet, metrics-server or none", c.Fallback))
+	}
+	check(!c.NamespaceScoped() || c.Fallback != FallbackKubelet,
+		"fallback kubelet needs cluster-wide nodes/proxy access and cannot be used with watchNamespaces")
+	for i, ns := range c.WatchNamespaces {
+		check(len(validation.IsDNS1123Label(ns)) == 0, "watchNamespaces[%d] %q is not a valid namespace name", i, ns)
+	}
+
+	_, err := logging.ParseLevel(c.Logging.Level)
+	check(err == nil, "logging.level %q must be debug, info, warn or error", c.Logging.Level)
+	check(c.Logging.Format == "text" || c.Logging.Format == "json", "logging.format %q must be text or json", c.Logging.Format)
+
+	check(c.API.QPS > 0 && c.API.Burst > 0, "api.qps and api.burst must be positive")
+	check(c.API.Impersonate.User != "" || len(c.API.Impersonate.Groups) == 0,
+		"api.impersonate.groups requires api.impersonate.user")
+
+	check(c.Prometheus.URL != "", "prometheus.url must be set")
+	check(c.Prometheus.Timeout.Duration > 0, "prometheus.timeout must be positive")
+	check(c.Prometheus.QPS > 0 && c.Prometheus.Burst > 0, "prometheus.qps and prometheus.burst must be positive")
+	s := c.Prometheus.Schema
+	check(s.CpuMetric != "" && s.MemoryMetric != "" && s.RssMetric != "" && s.UsageMetric != "" && s.InactiveFileMetric != "",
+		"prometheus.schema metric names must not be empty")
+	check(s.NamespaceLabel != "" && s.PodLabel != "" && s.ContainerLabel != "",
+		"prometheus.schema label names must not be empty")
+
+	check(c.Recommendation.Headroom >= 1, "recommendation.headroom must be at least 1")
+	check(c.Recommendation.MinCpu.Sign() >= 0, "recommendation.minCpu must not be negative")
+	check(c.Recommendation.MinMemory.Sign() >= 0, "recommendation.minMemory must not be negative")
+	h := c.Recommendation.Hysteresis
+	check(h.Relative >= 0, "recommendation.hysteresis.relative must not be negative")
+	check(h.MinCpuChange.Sign() >= 0 && h.MinMemoryChange.Sign() >= 0, "recommendation.hysteresis minimum changes must not be negative")
+	check(h.MinStableTime.Duration >= 0, "recommendation.hysteresis.minStableTime must not be negative")
+	check(c.History.MaxEntries >= 0, "history.maxEntries must not be negative")
+	check(c.History.MaxAge.Duration >= 0, "history.maxAge must not be negative")
+	check(c.Reports.TopN >= 0, "reports.topN must not be negative")
+	a := c.AutoApply
+	check(a.Mode == ApplyTemplate || a.Mode == ApplyInPlace, "autoApply.mode %q must be template or inPlace", a.Mode)
+	check(a.MaxChange > 0, "autoApply.maxChange must be positive")
+	check(a.MinDataAge.Duration >= 0, "autoApply.minDataAge must not be negative")
+	check(a.Cooldown.Duration >= 0, "autoApply.cooldown must not be negative")
+	for i, day := range a.MaintenanceWindow.Days {
+		_, ok := Weekdays[day]
+		check(ok, "autoApply.maintenanceWindow.days[%d] %q must be Mon, Tue, Wed, Thu, Fri, Sat or Sun", i, day)
+	}
+	check((a.MaintenanceWindow.Start == "") == (a.MaintenanceWindow.End == ""),
+		"autoApply.maintenanceWindow.start and end must be set together")
+	check(a.MaintenanceWindow.Start == "" || a.MaintenanceWindow.Start != a.MaintenanceWindow.End,
+		"autoApply.maintenanceWindow.start and end must differ")
+	for _, t := range []string{a.MaintenanceWindow.Start, a.MaintenanceWindow.End} {
+		if t != "" {
+			_, err := time.Parse(TimeOfDay, t)
+			check(err == nil, "autoApply.maintenanceWindow time %q must be HH:MM", t)
+		}
+	}
+	_, err = time.LoadLocation(a.MaintenanceWindow.TimeZone)
+	check(err == nil, "autoApply.maintenanceWindow.timeZone %q is not a known time zone", a.MaintenanceWindow.TimeZone)
+
+	check(!c.Webhook.Enabled || (c.Webhook.Addr != "" && c.Webhook.CertDir != ""), "webhook.addr and webhook.certDir must be set when the webhook is enabled")
+	check(c.Webhook.Timeout.Duration > 0, "webhook.timeout must be positive")
+	check(c.Webhook.QPS > 0 && c.Webhook.Burst > 0, "webhook.qps and webhook.burst must be positive")
+	check(c.HTTP.Addr != "", "http.addr must be set")
+	check(c.Health.MaxMissedScans > 0, "health.maxMissedScans must be at least 1")
+	check(c.LeaderElection.LeaseName != "", "leaderElection.leaseName must be set")
+
+	seen := map[string]bool{}
+	for i, cl := range c.Clusters {
+		check(len(validation.IsDNS1123Label(cl.Name)) == 0, "clusters[%d].name %q must be a DNS label", i, cl.Name)
+		check(!seen[cl.Name], "clusters[%d].name %q is not unique", i, cl.Name)
+		seen[cl.Name] = true
+	}
+	check(!c.Hub.Enabled || c.Hub.Namespace != "", "hub.namespace must be set when the hub is enabled")
+	check(!c.Hub.Enabled || len(c.Clusters) > 0, "hub.enabled requires clusters to be listed")
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration:\n  - %s", strings.Join(problems, "\n  - "))
+	}
+	return nil
+}
+
+// applyEnvOverrides lets the legacy environment variables take precedence over the file
+func applyEnvOverrides(c *Config) error {
+	var problems []string
+
+	str := func(key string, dst *string) {
+		if v := os.Getenv(key); v != "" {
+			*dst = v
+		}
+	}
+	duration := func(key string, dst *Duration) {
+		if v := os.Getenv(key); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %v", key, err))
+				return
+			}
+			dst.Duration = d
+		}
+	}
+	integer := func(key string, dst *int) {
+		if v := os.Getenv(key); v != "" {
+			i, err := strconv.Atoi(v)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %v", key, err))
+				return
+			}
+			*dst = i
+		}
+	}
+	float := func(key string, dst *float64) {
+		if v := os.Getenv(key); v != "" {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %v", key, err))
+				return
+			}
+			*dst = f
+		}
+	}
+	boolean := func(key string, dst *bool) {
+		if v := os.Getenv(key); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %v", key, err))
+				return
+			}
+			*dst = b
+		}
+	}
+
+	list := func(key string, dst *[]string) {
+		if v := os.Getenv(key); v != "" {
+			*dst = nil
+			for n := range strings.SplitSeq(v, ",") {
+				*dst = append(*dst, strings.TrimSpace(n))
+			}
+		}
+	}
+
+	duration("SCAN_INTERVAL", &c.ScanInterval)
+	integer("WORKERS", &c.Workers)
+	duration("WORKLOAD_TIMEOUT", &c.WorkloadTimeout)
+	duration("SHUTDOWN_GRACE_PERIOD", &c.ShutdownGracePeriod)
+	list("IGNORED_NAMESPACES", &c.IgnoredNamespaces)
+	list("WATCH_NAMESPACES", &c.WatchNamespaces)
+	str("FALLBACK_SOURCE", &c.Fallback)
+	str("MEMORY_METRIC", &c.MemoryMetric)
+	c.MemoryMetric = strings.ToLower(c.MemoryMetric)
+
+	str("LOG_LEVEL", &c.Logging.Level)
+	str("LOG_FORMAT", &c.Logging.Format)
+
+	float("API_QPS", &c.API.QPS)
+	integer("API_BURST", &c.API.Burst)
+
+	str("PROMETHEUS_URL", &c.Prometheus.URL)
+	str("PROMETHEUS_TENANT", &c.Prometheus.Tenant)
+	duration("PROMETHEUS_TIMEOUT", &c.Prometheus.Timeout)
+	// Deprecated: BATCH_DELAY paused between workloads. A delay maps to one Prometheus query per
+	// delay; PROMETHEUS_QPS takes precedence.
+	if v := os.Getenv("BATCH_DELAY"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			problems = append(problems, fmt.Sprintf("BATCH_DELAY: %q must be a positive duration", v))
+		} else {
+			c.Prometheus.QPS = 1 / d.Seconds()
+		}
+	}
+	float("PROMETHEUS_QPS", &c.Prometheus.QPS)
+	integer("PROMETHEUS_BURST", &c.Prometheus.Burst)
+	boolean("OPENSHIFT_ENABLED", &c.Prometheus.OpenShift)
+	str("PROMETHEUS_CPU_METRIC", &c.Prometheus.Schema.CpuMetric)
+	str("PROMETHEUS_MEMORY_METRIC", &c.Prometheus.Schema.MemoryMetric)
+	str("PROMETHEUS_MEMORY_RSS_METRIC", &c.Prometheus.Schema.RssMetric)
+	str("PROMETHEUS_MEMORY_USAGE_METRIC", &c.Prometheus.Schema.UsageMetric)
+	str("PROMETHEUS_MEMORY_INACTIVE_FILE_METRIC", &c.Prometheus.Schema.InactiveFileMetric)
+	str("PROMETHEUS_NAMESPACE_LABEL", &c.Prometheus.Schema.NamespaceLabel)
+	str("PROMETHEUS_POD_LABEL", &c.Prometheus.Schema.PodLabel)
+	str("PROMETHEUS_CONTAINER_LABEL", &c.Prometheus.Schema.ContainerLabel)
+	str("PROMETHEUS_CPU_QUERY", &c.Prometheus.Schema.CpuQuery)
+	str("PROMETHEUS_MEMORY_QUERY", &c.Prometheus.Schema.MemoryQuery)
+
+	str("HTTP_ADDR", &c.HTTP.Addr)
+	boolean("ENABLE_PPROF", &c.HTTP.Pprof)
+	integer("HEALTH_MAX_MISSED_SCANS", &c.Health.MaxMissedScans)
+
+	boolean("LEADER_ELECTION", &c.LeaderElection.Enabled)
+	str("LEADER_ELECTION_ID", &c.LeaderElection.LeaseName)
+	str("LEADER_ELECTION_NAMESPACE", &c.LeaderElection.Namespace)
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid environment overrides:\n  - %s", strings.Join(problems, "\n  - "))
+	}
+	return nil
+}
+
+// --- Current Configuration ---
+
+var current atomic.Pointer[Config]
+
+// Get returns the active configuration. Callers should read it once per operation.
+func Get() *Config {
+	if c := current.Load(); c != nil {
+		return c
+	}
+	return Default()
+}
+
+// Set replaces the active configuration
+func Set(c *Config) {
+	current.Store(c)
+}
@@ -0,0 +1,48 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// Watch polls the config file and calls onChange with each new valid configuration.
+// Polling (rather than inotify) copes with the symlink swap kubelet does for ConfigMap volumes.
+// An invalid file is logged and the previous configuration stays active.
+func Watch(ctx context.Context, path string, interval time.Duration, onChange func(*Config)) {
+	if path == "" {
+		return
+	}
+
+	last, _ := os.ReadFile(path)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			slog.Error("Failed to read config file", "path", path, "error", err)
+			continue
+		}
+		if bytes.Equal(data, last) {
+			continue
+		}
+		last = data
+
+		cfg, err := Load(path)
+		if err != nil {
+			slog.Error("Config file changed but is invalid, keeping previous configuration", "path", path, "error", err)
+			continue
+		}
+		slog.Info("Config file reloaded", "path", path)
+		onChange(cfg)
+	}
+}
@@ -4,16 +4,28 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"os"
+	"log/slog"
 	"strconv"
 	"strings"
 
+	"github.com/joe-l-mathew/kube-resource-suggest/pkg/config"
+	"github.com/joe-l-mathew/kube-resource-suggest/pkg/metrics"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 )
 
+// Reasons for falling back from Prometheus
+const (
+	FallbackPrometheusUnreachable = "PrometheusUnreachable"
+	FallbackPrometheusNoData      = "PrometheusNoData"
+)
+
+// WindowInstant is the Window of suggestions based on a single usage reading
+const WindowInstant = "instant"
+
 // SuggestionResult holds the recommended resources and status
 type SuggestionResult struct {
 	WorkloadName    string
@@ -28,6 +40,68 @@ type SuggestionResult struct {
 	MemoryLimit     string
 	Status          string
 	Source          string
+	MemoryMetric    string
+	// Window is the usage window analysed ("instant" for point-in-time sources)
+	Window string
+	// Samples is the number of pods whose usage contributed to this container's suggestion
+	Samples int64
+	// FallbackReason says why Prometheus was not used; empty when it was
+	FallbackReason string
+
+	// Numeric values behind the strings above, for metrics and aggregation
+	CurrentCpuRequestNano     int64
+	CurrentCpuLimitNano       int64
+	CurrentMemoryRequestBytes int64
+	CurrentMemoryLimitBytes   int64
+	TargetCpuRequestNano      int64
+	TargetCpuLimitNano        int64
+	TargetMemoryRequestBytes  int64
+	TargetMemoryLimitBytes    int64
+}
+
+// MemoryMetric selects which memory series recommendations are based on
+type MemoryMetric string
+
+const (
+	// MemoryMetricWorkingSet includes reclaimable active page cache (default)
+	MemoryMetricWorkingSet MemoryMetric = "workingset"
+	// MemoryMetricRSS uses anonymous memory only
+	MemoryMetricRSS MemoryMetric = "rss"
+	// MemoryMetricCacheAware uses max(usage - inactive file cache, rss)
+	MemoryMetricCacheAware MemoryMetric = "cacheaware"
+)
+
+// MemoryMetricAnnotation lets a workload override the memory metric
+const MemoryMetricAnnotation = "krs.io/memory-metric"
+
+// ParseMemoryMetric validates a memory metric name
+func ParseMemoryMetric(s string) (MemoryMetric, error) {
+	switch m := MemoryMetric(strings.ToLower(strings.TrimSpace(s))); m {
+	case MemoryMetricWorkingSet, MemoryMetricRSS, MemoryMetricCacheAware:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown memory metric %q (expected workingset, rss or cacheaware)", s)
+}
+
+// GetDefaultMemoryMetric returns the cluster-wide memory metric from the configuration
+func GetDefaultMemoryMetric() MemoryMetric {
+	m, err := ParseMemoryMetric(config.Get().MemoryMetric)
+	if err != nil {
+		return MemoryMetricWorkingSet
+	}
+	return m
+}
+
+// GetMemoryMetric returns the memory metric for a workload, honouring its annotation
+func GetMemoryMetric(workload unstructured.Unstructured) MemoryMetric {
+	if val, ok := workload.GetAnnotations()[MemoryMetricAnnotation]; ok {
+		m, err := ParseMemoryMetric(val)
+		if err == nil {
+			return m
+		}
+		slog.Warn("Invalid memory metric annotation", "workload", workload.GetName(), "namespace", workload.GetNamespace(), "kind", workload.GetKind(), "error", err)
+	}
+	return GetDefaultMemoryMetric()
 }
 
 // PodMetrics holds parsed metrics for a single pod
@@ -37,39 +111,68 @@ type PodMetrics struct {
 
 // GenerateLogic is the main entry point
 
-func GenerateLogic(client dynamic.Interface, coreClient *kubernetes.Clientset, workload unstructured.Unstructured) []*SuggestionResult {
+func GenerateLogic(ctx context.Context, client dynamic.Interface, coreClient *kubernetes.Clientset, prom PrometheusTarget, workload unstructured.Unstructured) []*SuggestionResult {
 	// 1. Try Prometheus
-	promResults := GeneratePrometheusSuggestions(client, workload)
+	promResults := GeneratePrometheusSuggestions(ctx, client, prom, workload)
 	if promResults != nil {
 		return promResults
 	}
 
-	// 2. Fallback to Kubelet (Direct Pod Usage)
-	return GenerateKubeletSuggestions(coreClient, workload)
+	// Don't fall back if we are shutting down or out of time
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	// 2. Fallback to the configured real-time source
+	var results []*SuggestionResult
+	switch config.Get().FallbackSource() {
+	case config.FallbackMetricsServer:
+		metrics.MetricsServerFallbacks.Inc()
+		results = GenerateMetricsServerSuggestions(ctx, client, workload)
+	case config.FallbackNone:
+		return nil
+	default:
+		// Kubelet (Direct Pod Usage)
+		metrics.KubeletFallbacks.Inc()
+		results = GenerateKubeletSuggestions(ctx, coreClient, workload)
+	}
+
+	reason := FallbackPrometheusNoData
+	if PrometheusUnreachable(prom) {
+		reason = FallbackPrometheusUnreachable
+	}
+	for _, res := range results {
+		res.FallbackReason = reason
+	}
+	return results
 }
 
 // GenerateKubeletSuggestions returns a list of suggestions using local Kubelet Summary API
-func GenerateKubeletSuggestions(client *kubernetes.Clientset, workload unstructured.Unstructured) []*SuggestionResult {
+func GenerateKubeletSuggestions(ctx context.Context, client *kubernetes.Clientset, workload unstructured.Unstructured) []*SuggestionResult {
 	name := workload.GetName()
 	ns := workload.GetNamespace()
 	kind := workload.GetKind()
+	memMetric := GetMemoryMetric(workload)
+	log := slog.With("workload", name, "namespace", ns, "kind", kind, "source", "Kubelet")
 
 	// 1. Get the Label Selector
 	selectorMap, found, _ := unstructured.NestedStringMap(workload.Object, "spec", "selector", "matchLabels")
 	if !found || len(selectorMap) == 0 {
+		log.Debug("No selector labels")
 		return nil
 	}
 	selectorStr := mapToString(selectorMap)
 
 	// 2. List Pods
-	podList, err := client.CoreV1().Pods(ns).List(context.TODO(), metav1.ListOptions{
+	podList, err := client.CoreV1().Pods(ns).List(ctx, metav1.ListOptions{
 		LabelSelector: selectorStr,
 	})
 	if err != nil {
-		fmt.Printf("Error listing pods: %v\n", err)
+		log.Error("Error listing pods", "error", err)
 		return nil
 	}
 	if len(podList.Items) == 0 {
+		log.Debug("No pods found", "selector", selectorStr)
 		return nil
 	}
 	// podCount := int64(len(podList.Items))
@@ -96,13 +199,16 @@ func GenerateKubeletSuggestions(client *kubernetes.Clientset, workload unstructu
 		if p.Status.Phase != "Running" {
 			continue
 		}
-		pm, err := getPodMetricsFromKubelet(client, p.Spec.NodeName, p.Name, p.Namespace)
-		if err == nil {
-			podMetricsMap[p.Name] = pm
+		pm, err := getPodMetricsFromKubelet(ctx, client, p.Spec.NodeName, p.Name, p.Namespace, memMetric)
+		if err != nil {
+			log.Debug("Error reading Kubelet summary", "pod", p.Name, "node", p.Spec.NodeName, "error", err)
+			continue
 		}
+		podMetricsMap[p.Name] = pm
 	}
 
 	if len(podMetricsMap) == 0 {
+		log.Debug("No running pods with Kubelet metrics")
 		return nil
 	}
 	// Re-adjust pod count to successful metrics
@@ -116,22 +222,31 @@ func GenerateKubeletSuggestions(client *kubernetes.Clientset, workload unstructu
 			continue
 		}
 		containerName := cMap["name"].(string)
+		clog := log.With("container", containerName)
 
 		var totalCpuUsage int64 = 0
 		var totalMemUsage int64 = 0
+		var samples int64 = 0
 
 		for _, pm := range podMetricsMap {
 			if usage, ok := pm.Containers[containerName]; ok {
 				totalCpuUsage += usage.CpuNano
 				totalMemUsage += usage.MemBytes
+				samples++
 			}
 		}
+		if samples == 0 {
+			clog.Debug("Container not in any Kubelet summary", "pods", effectivePodCount)
+		}
 
 		avgCpu := totalCpuUsage / effectivePodCount
 		avgMem := totalMemUsage / effectivePodCount
 
 		// Delegate to shared helper
 		res := makeSuggestion(name, kind, containerName, idx, totalContainers, effectivePodCount, float64(avgCpu), float64(avgMem), cMap, "Kubelet")
+		res.MemoryMetric = string(memMetric)
+		res.Window = WindowInstant
+		res.Samples = samples
 		results = append(results, res)
 	}
 
@@ -144,7 +259,7 @@ type ResourceUsage struct {
 }
 
 // getPodMetricsFromKubelet queries the Node's summary API via APIServer proxy
-func getPodMetricsFromKubelet(client *kubernetes.Clientset, nodeName, podName, namespace string) (PodMetrics, error) {
+func getPodMetricsFromKubelet(ctx context.Context, client *kubernetes.Clientset, nodeName, podName, namespace string, memMetric MemoryMetric) (PodMetrics, error) {
 	// Path: /api/v1/nodes/{node}/proxy/stats/summary
 	// Check if this node is reachable? We just try.
 	// We need to decode the Summary JSON.
@@ -163,6 +278,7 @@ func getPodMetricsFromKubelet(client *kubernetes.Clientset, nodeName, podName, n
 				} `json:"cpu"`
 				Memory struct {
 					WorkingSetBytes uint64 `json:"workingSetBytes"`
+					RSSBytes        uint64 `json:"rssBytes"`
 				} `json:"memory"`
 			} `json:"containers"`
 		} `json:"pods"`
@@ -173,7 +289,7 @@ func getPodMetricsFromKubelet(client *kubernetes.Clientset, nodeName, podName, n
 		Name(nodeName).
 		SubResource("proxy").
 		Suffix("stats/summary").
-		Do(context.TODO()).
+		Do(ctx).
 		Raw()
 
 	if err != nil {
@@ -190,9 +306,18 @@ func getPodMetricsFromKubelet(client *kubernetes.Clientset, nodeName, podName, n
 	for _, p := range s.Pods {
 		if p.PodRef.Name == podName && p.PodRef.Namespace == namespace {
 			for _, c := range p.Containers {
+				mem := int64(c.Memory.WorkingSetBytes)
+				switch memMetric {
+				case MemoryMetricRSS:
+					mem = int64(c.Memory.RSSBytes)
+				case MemoryMetricCacheAware:
+					// max(usage - inactive file, rss). The summary has no inactive file series,
+					// but its working set is exactly usage minus inactive file
+					mem = max(int64(c.Memory.WorkingSetBytes), int64(c.Memory.RSSBytes))
+				}
 				pm.Containers[c.Name] = ResourceUsage{
 					CpuNano:  int64(c.CPU.UsageNanoCores),
-					MemBytes: int64(c.Memory.WorkingSetBytes),
+					MemBytes: mem,
 				}
 			}
 			return pm, nil
@@ -235,17 +360,18 @@ func makeSuggestion(
 		}
 	}
 
-	// 2. Calculate Recommended
-	recommendedCpuNano := usageCpuNano * 1.2
-	recommendedMemBytes := usageMemBytes * 1.2
+	// 2. Calculate Recommended (headroom and floors are configurable)
+	rec := config.Get().Recommendation
+	recommendedCpuNano := usageCpuNano * rec.Headroom
+	recommendedMemBytes := usageMemBytes * rec.Headroom
 
-	const MinCpuMilli = 30
-	const MinMemMi = 50
-	if recommendedCpuNano < float64(MinCpuMilli*1000000) {
-		recommendedCpuNano = float64(MinCpuMilli * 1000000)
+	minCpuNano := float64(rec.MinCpu.ScaledValue(resource.Nano))
+	minMemBytes := float64(rec.MinMemory.Value())
+	if recommendedCpuNano < minCpuNano {
+		recommendedCpuNano = minCpuNano
 	}
-	if recommendedMemBytes < float64(MinMemMi*1024*1024) {
-		recommendedMemBytes = float64(MinMemMi * 1024 * 1024)
+	if recommendedMemBytes < minMemBytes {
+		recommendedMemBytes = minMemBytes
 	}
 
 	// Helper for rounding up to nearest 5
@@ -288,57 +414,65 @@ func makeSuggestion(
 		targetMemLimBytes = targetMemReqBytes
 	}
 
+	res := &SuggestionResult{
+		WorkloadName:    workloadName,
+		WorkloadType:    workloadType,
+		ContainerName:   containerName,
+		ContainerIndex:  containerIndex,
+		TotalContainers: totalContainers,
+		PodCount:        podCount, // For Prometheus we might not know exact active pod count, pass 0 or filtered count
+		Source:          source,
+
+		CurrentCpuRequestNano:     currentCpuReqNano,
+		CurrentCpuLimitNano:       currentCpuLimNano,
+		CurrentMemoryRequestBytes: currentMemReqBytes,
+		CurrentMemoryLimitBytes:   currentMemLimBytes,
+		TargetCpuRequestNano:      targetCpuReqNano,
+		TargetCpuLimitNano:        targetCpuLimNano,
+		TargetMemoryRequestBytes:  targetMemReqBytes,
+		TargetMemoryLimitBytes:    targetMemLimBytes,
+	}
+	res.refresh()
+	return res
+}
+
+// refresh derives the status and display strings from the numeric values
+func (s *SuggestionResult) refresh() {
 	// 4. Determine Status
-	status := "Optimal"
+	s.Status = "Optimal"
 
-	cpuUp := targetCpuReqNano > currentCpuReqNano
-	memUp := targetMemReqBytes > currentMemReqBytes
-	cpuDown := targetCpuReqNano < currentCpuReqNano
-	memDown := targetMemReqBytes < currentMemReqBytes
+	cpuUp := s.TargetCpuRequestNano > s.CurrentCpuRequestNano
+	memUp := s.TargetMemoryRequestBytes > s.CurrentMemoryRequestBytes
+	cpuDown := s.TargetCpuRequestNano < s.CurrentCpuRequestNano
+	memDown := s.TargetMemoryRequestBytes < s.CurrentMemoryRequestBytes
 
 	if cpuUp || memUp {
-		status = "Underprovisioned"
+		s.Status = "Underprovisioned"
 	} else if cpuDown && memDown {
-		status = "Overprovisioned"
+		s.Status = "Overprovisioned"
 	} else if cpuDown || memDown {
-		status = "Overprovisioned" // Mixed
+		s.Status = "Overprovisioned" // Mixed
 	}
 
 	// 5. Format Strings
-	fmtCpu := func(nano int64) string {
-		if nano == 0 {
-			return "0m (Not Set)"
-		}
-		return fmt.Sprintf("%dm", nano/1000000)
-	}
-	fmtMem := func(bytes int64) string {
-		if bytes == 0 {
-			return "0Mi (Not Set)"
-		}
-		return fmt.Sprintf("%dMi", bytes/(1024*1024))
-	}
-
-	cpuRequestStr := fmt.Sprintf("%s->%s", fmtCpu(currentCpuReqNano), fmtCpu(targetCpuReqNano))
-	memRequestStr := fmt.Sprintf("%s->%s", fmtMem(currentMemReqBytes), fmtMem(targetMemReqBytes))
+	s.CpuRequest = fmt.Sprintf("%s->%s", fmtCpu(s.CurrentCpuRequestNano), fmtCpu(s.TargetCpuRequestNano))
+	s.MemoryRequest = fmt.Sprintf("%s->%s", fmtMem(s.CurrentMemoryRequestBytes), fmtMem(s.TargetMemoryRequestBytes))
+	s.CpuLimit = fmt.Sprintf("%s->%s", fmtCpu(s.CurrentCpuLimitNano), fmtCpu(s.TargetCpuLimitNano))
+	s.MemoryLimit = fmt.Sprintf("%s->%s", fmtMem(s.CurrentMemoryLimitBytes), fmtMem(s.TargetMemoryLimitBytes))
+}
 
-	var cpuLimitStr, memLimitStr string
-	cpuLimitStr = fmt.Sprintf("%s->%s", fmtCpu(currentCpuLimNano), fmtCpu(targetCpuLimNano))
-	memLimitStr = fmt.Sprintf("%s->%s", fmtMem(currentMemLimBytes), fmtMem(targetMemLimBytes))
+func fmtCpu(nano int64) string {
+	if nano == 0 {
+		return "0m (Not Set)"
+	}
+	return fmt.Sprintf("%dm", nano/1000000)
+}
 
-	return &SuggestionResult{
-		WorkloadName:    workloadName,
-		WorkloadType:    workloadType,
-		ContainerName:   containerName,
-		ContainerIndex:  containerIndex,
-		TotalContainers: totalContainers,
-		PodCount:        podCount, // For Prometheus we might not know exact active pod count, pass 0 or filtered count
-		CpuRequest:      cpuRequestStr,
-		CpuLimit:        cpuLimitStr,
-		MemoryRequest:   memRequestStr,
-		MemoryLimit:     memLimitStr,
-		Status:          status,
-		Source:          source,
+func fmtMem(bytes int64) string {
+	if bytes == 0 {
+		return "0Mi (Not Set)"
 	}
+	return fmt.Sprintf("%dMi", bytes/(1024*1024))
 }
 
 // --- Helpers ---
@@ -400,9 +534,18 @@ func parseMemoryToBytes(s string) int64 {
 }
 
 func GetPrometheusUrl() string {
-	url := os.Getenv("PROMETHEUS_URL")
-	if url == "" {
-		url = "http://krs-prometheus-svc:9090"
-	}
-	return url
+	return config.Get().Prometheus.URL
+}
+
+// PrometheusTarget is the Prometheus endpoint used for one cluster
+type PrometheusTarget struct {
+	URL string
+	// Tenant is sent as X-Scope-OrgID for multi-tenant backends (Thanos, Cortex, Mimir)
+	Tenant string
+}
+
+// GetPrometheusTarget returns the configured default Prometheus endpoint
+func GetPrometheusTarget() PrometheusTarget {
+	p := config.Get().Prometheus
+	return PrometheusTarget{URL: p.URL, Tenant: p.Tenant}
 }
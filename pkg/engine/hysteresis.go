@@ -0,0 +1,100 @@
+package engine
+
+import (
+	"time"
+
+	"github.com/joe-l-mathew/kube-resource-suggest/pkg/config"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// Published is the recommendation currently published for a container, as input to Stabilize
+type Published struct {
+	// Current requests the recommendation was computed against; 0 if unknown
+	CurrentCpuRequestNano     int64
+	CurrentMemoryRequestBytes int64
+
+	TargetCpuRequestNano     int64
+	TargetCpuLimitNano       int64
+	TargetMemoryRequestBytes int64
+	TargetMemoryLimitBytes   int64
+	Status                   string
+
+	// PendingStatus is a status change held back since PendingSince
+	PendingStatus string
+	PendingSince  time.Time
+}
+
+// Stabilize applies hysteresis to s against the published recommendation prev (nil if none):
+//   - CPU and memory values that moved by less than the thresholds keep their published values.
+//   - A status change is held, with the published values, until it has persisted for MinStableTime.
+//     Changes of the workload's own requests are never held.
+//
+// s is updated in place. Returns what is now published, to pass as prev next time.
+func Stabilize(s *SuggestionResult, prev *Published, cfg config.HysteresisConfig, now time.Time) *Published {
+	if prev == nil {
+		return publishedOf(s, "", time.Time{})
+	}
+
+	// 1. Ignore small changes
+	minCpu := cfg.MinCpuChange.ScaledValue(resource.Nano)
+	if withinThreshold(prev.TargetCpuRequestNano, s.TargetCpuRequestNano, cfg.Relative, minCpu) &&
+		withinThreshold(prev.TargetCpuLimitNano, s.TargetCpuLimitNano, cfg.Relative, minCpu) {
+		s.TargetCpuRequestNano, s.TargetCpuLimitNano = prev.TargetCpuRequestNano, prev.TargetCpuLimitNano
+	}
+	minMem := cfg.MinMemoryChange.Value()
+	if withinThreshold(prev.TargetMemoryRequestBytes, s.TargetMemoryRequestBytes, cfg.Relative, minMem) &&
+		withinThreshold(prev.TargetMemoryLimitBytes, s.TargetMemoryLimitBytes, cfg.Relative, minMem) {
+		s.TargetMemoryRequestBytes, s.TargetMemoryLimitBytes = prev.TargetMemoryRequestBytes, prev.TargetMemoryLimitBytes
+	}
+	s.refresh()
+
+	// 2. Hold status flips until they are stable
+	if prev.Status == "" || s.Status == prev.Status || cfg.MinStableTime.Duration == 0 || currentChanged(s, prev) {
+		return publishedOf(s, "", time.Time{})
+	}
+	since := now
+	if prev.PendingStatus == s.Status {
+		since = prev.PendingSince
+	}
+	if now.Sub(since) >= cfg.MinStableTime.Duration {
+		return publishedOf(s, "", time.Time{})
+	}
+
+	pending := s.Status
+	s.TargetCpuRequestNano, s.TargetCpuLimitNano = prev.TargetCpuRequestNano, prev.TargetCpuLimitNano
+	s.TargetMemoryRequestBytes, s.TargetMemoryLimitBytes = prev.TargetMemoryRequestBytes, prev.TargetMemoryLimitBytes
+	s.refresh()
+	s.Status = prev.Status
+	return publishedOf(s, pending, since)
+}
+
+// withinThreshold reports whether next differs from prev by no more than the relative or absolute threshold
+func withinThreshold(prev, next int64, relative float64, absolute int64) bool {
+	d := next - prev
+	if d < 0 {
+		d = -d
+	}
+	return d <= absolute || float64(d) <= relative*float64(prev)
+}
+
+// currentChanged reports whether the workload's requests changed since prev was computed
+func currentChanged(s *SuggestionResult, prev *Published) bool {
+	if prev.CurrentCpuRequestNano == 0 && prev.CurrentMemoryRequestBytes == 0 {
+		return false // Unknown
+	}
+	return s.CurrentCpuRequestNano != prev.CurrentCpuRequestNano || s.CurrentMemoryRequestBytes != prev.CurrentMemoryRequestBytes
+}
+
+func publishedOf(s *SuggestionResult, pending string, since time.Time) *Published {
+	return &Published{
+		CurrentCpuRequestNano:     s.CurrentCpuRequestNano,
+		CurrentMemoryRequestBytes: s.CurrentMemoryRequestBytes,
+		TargetCpuRequestNano:      s.TargetCpuRequestNano,
+		TargetCpuLimitNano:        s.TargetCpuLimitNano,
+		TargetMemoryRequestBytes:  s.TargetMemoryRequestBytes,
+		TargetMemoryLimitBytes:    s.TargetMemoryLimitBytes,
+		Status:                    s.Status,
+		PendingStatus:             pending,
+		PendingSince:              since,
+	}
+}
@@ -0,0 +1,220 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/joe-l-mathew/kube-resource-suggest/pkg/config"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestWithinThreshold(t *testing.T) {
+	tests := []struct {
+		name       string
+		prev, next int64
+		relative   float64
+		absolute   int64
+		want       bool
+	}{
+		{"unchanged", 1000, 1000, 0, 0, true},
+		{"no thresholds", 1000, 1001, 0, 0, false},
+		{"at the absolute threshold", 1000, 1100, 0, 100, true},
+		{"above the absolute threshold", 1000, 1101, 0, 100, false},
+		{"absolute threshold downwards", 1000, 900, 0, 100, true},
+		{"at the relative threshold", 1000, 1100, 0.1, 0, true},
+		{"above the relative threshold", 1000, 1101, 0.1, 0, false},
+		{"relative threshold downwards", 1000, 899, 0.1, 0, false},
+		{"either threshold is enough", 1000, 1150, 0.1, 200, true},
+		{"relative of nothing is nothing", 0, 1, 0.5, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := withinThreshold(tt.prev, tt.next, tt.relative, tt.absolute); got != tt.want {
+				t.Errorf("withinThreshold(%d, %d, %v, %d) = %v, want %v", tt.prev, tt.next, tt.relative, tt.absolute, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStabilize(t *testing.T) {
+	const mi = 1024 * 1024
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	cfg := config.HysteresisConfig{
+		Relative:        0.1,
+		MinCpuChange:    resource.MustParse("50m"),
+		MinMemoryChange: resource.MustParse("64Mi"),
+		MinStableTime:   config.Duration{Duration: time.Hour},
+	}
+	noHold := cfg
+	noHold.MinStableTime = config.Duration{}
+
+	// suggestion has requests of 1 CPU and 1Gi and the given targets; limits are twice the requests
+	suggestion := func(cpuNano, memBytes int64) *SuggestionResult {
+		s := &SuggestionResult{
+			CurrentCpuRequestNano:     1e9,
+			CurrentMemoryRequestBytes: 1024 * mi,
+			TargetCpuRequestNano:      cpuNano,
+			TargetCpuLimitNano:        2 * cpuNano,
+			TargetMemoryRequestBytes:  memBytes,
+			TargetMemoryLimitBytes:    2 * memBytes,
+		}
+		s.refresh()
+		return s
+	}
+	published := func(cpuNano, memBytes int64, status string) *Published {
+		p := publishedOf(suggestion(cpuNano, memBytes), "", time.Time{})
+		p.Status = status
+		return p
+	}
+	pending := func(p *Published, status string, since time.Time) *Published {
+		p.PendingStatus, p.PendingSince = status, since
+		return p
+	}
+
+	tests := []struct {
+		name        string
+		suggestion  *SuggestionResult
+		prev        *Published
+		cfg         config.HysteresisConfig
+		wantCpu     int64
+		wantMem     int64
+		wantStatus  string
+		wantPending string
+		wantSince   time.Time
+	}{
+		{
+			name:       "first recommendation is published",
+			suggestion: suggestion(500e6, 512*mi),
+			wantCpu:    500e6,
+			wantMem:    512 * mi,
+			wantStatus: "Overprovisioned",
+		},
+		{
+			name:       "small changes keep the published values",
+			suggestion: suggestion(520e6, 540*mi),
+			prev:       published(500e6, 512*mi, "Overprovisioned"),
+			cfg:        cfg,
+			wantCpu:    500e6,
+			wantMem:    512 * mi,
+			wantStatus: "Overprovisioned",
+		},
+		{
+			name:       "changes beyond both thresholds are published",
+			suggestion: suggestion(600e6, 640*mi),
+			prev:       published(500e6, 512*mi, "Overprovisioned"),
+			cfg:        cfg,
+			wantCpu:    600e6,
+			wantMem:    640 * mi,
+			wantStatus: "Overprovisioned",
+		},
+		{
+			name:       "CPU and memory are stabilised separately",
+			suggestion: suggestion(520e6, 640*mi),
+			prev:       published(500e6, 512*mi, "Overprovisioned"),
+			cfg:        cfg,
+			wantCpu:    500e6,
+			wantMem:    640 * mi,
+			wantStatus: "Overprovisioned",
+		},
+		{
+			name:       "a limit beyond the thresholds publishes the request too",
+			suggestion: &SuggestionResult{CurrentCpuRequestNano: 1e9, TargetCpuRequestNano: 520e6, TargetCpuLimitNano: 2e9},
+			prev:       published(500e6, 0, "Overprovisioned"),
+			cfg:        cfg,
+			wantCpu:    520e6,
+			wantStatus: "Overprovisioned",
+		},
+		{
+			name:        "a status flip is held",
+			suggestion:  suggestion(1500e6, 1536*mi),
+			prev:        published(500e6, 512*mi, "Overprovisioned"),
+			cfg:         cfg,
+			wantCpu:     500e6,
+			wantMem:     512 * mi,
+			wantStatus:  "Overprovisioned",
+			wantPending: "Underprovisioned",
+			wantSince:   now,
+		},
+		{
+			name:        "a held flip keeps its start",
+			suggestion:  suggestion(1500e6, 1536*mi),
+			prev:        pending(published(500e6, 512*mi, "Overprovisioned"), "Underprovisioned", now.Add(-59*time.Minute)),
+			cfg:         cfg,
+			wantCpu:     500e6,
+			wantMem:     512 * mi,
+			wantStatus:  "Overprovisioned",
+			wantPending: "Underprovisioned",
+			wantSince:   now.Add(-59 * time.Minute),
+		},
+		{
+			name:       "a flip is published after MinStableTime",
+			suggestion: suggestion(1500e6, 1536*mi),
+			prev:       pending(published(500e6, 512*mi, "Overprovisioned"), "Underprovisioned", now.Add(-time.Hour)),
+			cfg:        cfg,
+			wantCpu:    1500e6,
+			wantMem:    1536 * mi,
+			wantStatus: "Underprovisioned",
+		},
+		{
+			name:        "a different flip starts over",
+			suggestion:  suggestion(1e9, 1024*mi),
+			prev:        pending(published(500e6, 512*mi, "Overprovisioned"), "Underprovisioned", now.Add(-2*time.Hour)),
+			cfg:         cfg,
+			wantCpu:     500e6,
+			wantMem:     512 * mi,
+			wantStatus:  "Overprovisioned",
+			wantPending: "Optimal",
+			wantSince:   now,
+		},
+		{
+			name:       "flips are not held without MinStableTime",
+			suggestion: suggestion(1500e6, 1536*mi),
+			prev:       published(500e6, 512*mi, "Overprovisioned"),
+			cfg:        noHold,
+			wantCpu:    1500e6,
+			wantMem:    1536 * mi,
+			wantStatus: "Underprovisioned",
+		},
+		{
+			name: "flips after the workload's requests changed are not held",
+			suggestion: func() *SuggestionResult {
+				s := suggestion(1e9, 1024*mi)
+				s.CurrentCpuRequestNano, s.CurrentMemoryRequestBytes = 500e6, 512*mi
+				s.refresh()
+				return s
+			}(),
+			prev:       published(500e6, 512*mi, "Overprovisioned"),
+			cfg:        cfg,
+			wantCpu:    1e9,
+			wantMem:    1024 * mi,
+			wantStatus: "Underprovisioned",
+		},
+		{
+			name:        "flips against a restored recommendation are held",
+			suggestion:  suggestion(1500e6, 1536*mi),
+			prev:        &Published{TargetCpuRequestNano: 500e6, TargetCpuLimitNano: 1e9, TargetMemoryRequestBytes: 512 * mi, TargetMemoryLimitBytes: 1024 * mi, Status: "Overprovisioned"},
+			cfg:         cfg,
+			wantCpu:     500e6,
+			wantMem:     512 * mi,
+			wantStatus:  "Overprovisioned",
+			wantPending: "Underprovisioned",
+			wantSince:   now,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Stabilize(tt.suggestion, tt.prev, tt.cfg, now)
+			s := tt.suggestion
+			if s.TargetCpuRequestNano != tt.wantCpu || s.TargetMemoryRequestBytes != tt.wantMem || s.Status != tt.wantStatus {
+				t.Errorf("suggestion = %d CPU, %d memory, %s; want %d, %d, %s",
+					s.TargetCpuRequestNano, s.TargetMemoryRequestBytes, s.Status, tt.wantCpu, tt.wantMem, tt.wantStatus)
+			}
+			if got.TargetCpuRequestNano != s.TargetCpuRequestNano || got.TargetMemoryRequestBytes != s.TargetMemoryRequestBytes || got.Status != s.Status {
+				t.Errorf("published %+v does not match the suggestion", got)
+			}
+			if got.PendingStatus != tt.wantPending || !got.PendingSince.Equal(tt.wantSince) {
+				t.Errorf("pending = %q since %v, want %q since %v", got.PendingStatus, got.PendingSince, tt.wantPending, tt.wantSince)
+			}
+		})
+	}
+}
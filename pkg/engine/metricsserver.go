@@ -0,0 +1,118 @@
+package engine
+
+import (
+	"context"
+	"log/slog"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// PodMetricsGVR is the metrics-server resource for per-pod usage
+var PodMetricsGVR = schema.GroupVersionResource{Group: "metrics.k8s.io", Version: "v1beta1", Resource: "pods"}
+
+// GenerateMetricsServerSuggestions returns suggestions from metrics-server (metrics.k8s.io).
+// Unlike the Kubelet source it only needs namespaced read access, so it works in namespace-scoped mode.
+// metrics-server reports the working set only, so the memory metric is always workingset.
+func GenerateMetricsServerSuggestions(ctx context.Context, client dynamic.Interface, workload unstructured.Unstructured) []*SuggestionResult {
+	name := workload.GetName()
+	ns := workload.GetNamespace()
+	kind := workload.GetKind()
+	log := slog.With("workload", name, "namespace", ns, "kind", kind, "source", "MetricsServer")
+
+	if m := GetMemoryMetric(workload); m != MemoryMetricWorkingSet {
+		log.Debug("metrics-server only reports the working set", "memoryMetric", m)
+	}
+
+	// 1. Get the Label Selector
+	selectorMap, found, _ := unstructured.NestedStringMap(workload.Object, "spec", "selector", "matchLabels")
+	if !found || len(selectorMap) == 0 {
+		log.Debug("No selector labels")
+		return nil
+	}
+
+	// 2. List PodMetrics for the workload's pods
+	list, err := client.Resource(PodMetricsGVR).Namespace(ns).List(ctx, metav1.ListOptions{
+		LabelSelector: mapToString(selectorMap),
+	})
+	if err != nil {
+		log.Error("Error listing pod metrics", "error", err)
+		return nil
+	}
+	if len(list.Items) == 0 {
+		log.Debug("No pod metrics found")
+		return nil
+	}
+
+	// metrics-server averages over a short window (e.g. "30s"), reported per pod
+	window, _, _ := unstructured.NestedString(list.Items[0].Object, "window")
+	if window == "" {
+		window = WindowInstant
+	}
+
+	podMetrics := make([]PodMetrics, 0, len(list.Items))
+	for _, item := range list.Items {
+		containers, _, _ := unstructured.NestedSlice(item.Object, "containers")
+		pm := PodMetrics{Containers: make(map[string]ResourceUsage)}
+		for _, cInt := range containers {
+			c, ok := cInt.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			cName, _, _ := unstructured.NestedString(c, "name")
+			cpuStr, _, _ := unstructured.NestedString(c, "usage", "cpu")
+			memStr, _, _ := unstructured.NestedString(c, "usage", "memory")
+			cpu, err1 := resource.ParseQuantity(cpuStr)
+			mem, err2 := resource.ParseQuantity(memStr)
+			if err1 != nil || err2 != nil {
+				continue
+			}
+			pm.Containers[cName] = ResourceUsage{
+				CpuNano:  cpu.ScaledValue(resource.Nano),
+				MemBytes: mem.Value(),
+			}
+		}
+		podMetrics = append(podMetrics, pm)
+	}
+	effectivePodCount := int64(len(podMetrics))
+
+	// 3. Get Containers from Workload Spec
+	containersSpec, _, _ := unstructured.NestedSlice(workload.Object, "spec", "template", "spec", "containers")
+	totalContainers := len(containersSpec)
+
+	var results []*SuggestionResult
+	for idx, cInt := range containersSpec {
+		cMap, ok := cInt.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		containerName := cMap["name"].(string)
+		clog := log.With("container", containerName)
+
+		var totalCpuUsage, totalMemUsage, samples int64
+		for _, pm := range podMetrics {
+			if usage, ok := pm.Containers[containerName]; ok {
+				totalCpuUsage += usage.CpuNano
+				totalMemUsage += usage.MemBytes
+				samples++
+			}
+		}
+		if samples == 0 {
+			clog.Debug("Container not in any pod metrics", "pods", effectivePodCount)
+		}
+
+		avgCpu := totalCpuUsage / effectivePodCount
+		avgMem := totalMemUsage / effectivePodCount
+
+		res := makeSuggestion(name, kind, containerName, idx, totalContainers, effectivePodCount, float64(avgCpu), float64(avgMem), cMap, "MetricsServer")
+		res.MemoryMetric = string(MemoryMetricWorkingSet)
+		res.Window = window
+		res.Samples = samples
+		results = append(results, res)
+	}
+
+	return results
+}
@@ -6,59 +6,80 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"os"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"golang.org/x/time/rate"
+
+	"github.com/joe-l-mathew/kube-resource-suggest/pkg/config"
+	"github.com/joe-l-mathew/kube-resource-suggest/pkg/metrics"
+
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/dynamic"
 )
 
-// State tracking for logging
-var lastPrometheusReachable = true
+// State tracking for logging per Prometheus URL, shared by concurrent workers
+var prometheusUnreachable sync.Map // URL -> *atomic.Bool
+
+func unreachableState(promURL string) *atomic.Bool {
+	v, _ := prometheusUnreachable.LoadOrStore(promURL, new(atomic.Bool))
+	return v.(*atomic.Bool)
+}
+
+// promLimiter is a token bucket shared by all workers for Prometheus calls
+var promLimiter = rate.NewLimiter(10, 20)
+
+// SetPrometheusRateLimit configures the Prometheus token bucket
+func SetPrometheusRateLimit(qps float64, burst int) {
+	promLimiter.SetLimit(rate.Limit(qps))
+	promLimiter.SetBurst(burst)
+}
+
+// PrometheusUnreachable reports whether the last connectivity check against prom failed
+func PrometheusUnreachable(prom PrometheusTarget) bool {
+	return unreachableState(prom.URL).Load()
+}
 
 // GeneratePrometheusSuggestions tries to fetch metrics from Prometheus.
 // Returns nil if Prometheus is unreachable or returns no data.
-func GeneratePrometheusSuggestions(client dynamic.Interface, workload unstructured.Unstructured) []*SuggestionResult {
-	promURL := GetPrometheusUrl()
+func GeneratePrometheusSuggestions(ctx context.Context, client dynamic.Interface, prom PrometheusTarget, workload unstructured.Unstructured) []*SuggestionResult {
+	promURL := prom.URL
 
-	// 1. Check Connectivity
-	reachable := isPrometheusReachable(promURL)
+	name := workload.GetName()
+	ns := workload.GetNamespace()
+	kind := workload.GetKind()
+	log := slog.With("workload", name, "namespace", ns, "kind", kind, "source", "Prometheus")
 
-	isDebug := os.Getenv("LOG_LEVEL") == "debug"
+	// 1. Check Connectivity
+	reachable := isPrometheusReachable(ctx, prom)
+	unreachable := unreachableState(promURL)
 
 	if !reachable {
-		if lastPrometheusReachable {
-			fmt.Printf("Warning: Prometheus at %s is unreachable. Falling back to Kubelet.\n", promURL)
-			lastPrometheusReachable = false
-		}
-		if isDebug {
-			fmt.Printf("Debug: Prometheus unreachable at %s\n", promURL)
+		if unreachable.CompareAndSwap(false, true) {
+			slog.Warn("Prometheus is unreachable, falling back to Kubelet", "url", promURL)
 		}
+		log.Debug("Prometheus unreachable", "url", promURL)
 		return nil
 	}
 
 	// If it was previously unreachable and now is reachable
-	if !lastPrometheusReachable {
-		fmt.Printf("Info: Prometheus connection restored at %s.\n", promURL)
-		lastPrometheusReachable = true
+	if unreachable.CompareAndSwap(true, false) {
+		slog.Info("Prometheus connection restored", "url", promURL)
 	}
 
-	name := workload.GetName()
-	ns := workload.GetNamespace()
-	kind := workload.GetKind()
-
 	// 2. Get Containers from Spec
 	podSpec, found, _ := unstructured.NestedMap(workload.Object, "spec", "template", "spec")
 	if !found {
-		if isDebug {
-			fmt.Printf("Debug: No pod spec found for %s/%s\n", ns, name)
-		}
+		log.Debug("No pod spec found")
 		return nil
 	}
 	containersSpec, _, _ := unstructured.NestedSlice(podSpec, "containers")
@@ -86,9 +107,7 @@ func GeneratePrometheusSuggestions(client dynamic.Interface, workload unstructur
 	// 4. Get Labels for Selector and List Pods
 	selectorMap, found, _ := unstructured.NestedStringMap(workload.Object, "spec", "selector", "matchLabels")
 	if !found || len(selectorMap) == 0 {
-		if isDebug {
-			fmt.Printf("Debug: No selector labels for %s/%s\n", ns, name)
-		}
+		log.Debug("No selector labels")
 		return nil
 	}
 
@@ -98,17 +117,15 @@ func GeneratePrometheusSuggestions(client dynamic.Interface, workload unstructur
 	// List Pods to get their names
 	// cAdvisor metrics usually have 'pod' label matching the pod name, but not 'app' labels by default.
 	podGVR := schema.GroupVersionResource{Group: "", Version: "v1", Resource: "pods"}
-	podList, err := client.Resource(podGVR).Namespace(ns).List(context.TODO(), metav1.ListOptions{
+	podList, err := client.Resource(podGVR).Namespace(ns).List(ctx, metav1.ListOptions{
 		LabelSelector: selectorStr,
 	})
 	if err != nil {
-		fmt.Printf("Error listing pods: %v\n", err)
+		log.Error("Error listing pods", "error", err)
 		return nil
 	}
 	if len(podList.Items) == 0 {
-		if isDebug {
-			fmt.Printf("Debug: No pods found for %s/%s using selector %s\n", ns, name, selectorStr)
-		}
+		log.Debug("No pods found", "selector", selectorStr)
 		// No active pods, can't reliably determine metric series names without external labeling logic
 		return nil
 	}
@@ -120,10 +137,10 @@ func GeneratePrometheusSuggestions(client dynamic.Interface, workload unstructur
 	// Create regex for pod names: (pod1|pod2|...)
 	podRegex := strings.Join(podNames, "|")
 
-	if isDebug {
-		fmt.Printf("Debug: Querying Prometheus for %s/%s. Range: %s. Pods: %s\n", ns, name, rangeStr, podRegex)
-	}
+	log.Debug("Querying Prometheus", "range", rangeStr, "pods", podRegex)
 
+	promSchema := GetPrometheusSchema()
+	memMetric := GetMemoryMetric(workload)
 	var results []*SuggestionResult
 
 	for idx, cInt := range containersSpec {
@@ -132,37 +149,40 @@ func GeneratePrometheusSuggestions(client dynamic.Interface, workload unstructur
 			continue
 		}
 		containerName := cMap["name"].(string)
+		clog := log.With("container", containerName)
 
 		// 5. Query Prometheus for this container
 		// We query for metrics matching any of the current pod names.
 		// We take the MAX over time for EACH pod, and then MAX over all pods.
+		// Metric and label names come from the configured schema.
+		cpuQuery, err := promSchema.CpuQuery(ns, containerName, podRegex, rangeStr)
+		if err != nil {
+			clog.Error("Error building CPU query", "error", err)
+			return nil
+		}
 
-		// CPU Query
-		// max(max_over_time(rate(container_cpu_usage_seconds_total{...}[5m])[7d:1m]))
-		cpuQuery := fmt.Sprintf("max(max_over_time(rate(container_cpu_usage_seconds_total{namespace=\"%s\", container=\"%s\", pod=~\"%s\"}[5m])[%s:1m]))",
-			ns, containerName, podRegex, rangeStr)
-
-		// Memory Query
-		// max(max_over_time(container_memory_working_set_bytes{...}[7d:1m]))
-		memQuery := fmt.Sprintf("max(max_over_time(container_memory_working_set_bytes{namespace=\"%s\", container=\"%s\", pod=~\"%s\"}[%s:1m]))",
-			ns, containerName, podRegex, rangeStr)
+		memQuery, err := promSchema.MemoryQuery(ns, containerName, podRegex, rangeStr, memMetric)
+		if err != nil {
+			clog.Error("Error building memory query", "error", err)
+			return nil
+		}
 
-		maxCpu, err := queryPrometheusValue(promURL, cpuQuery)
+		maxCpu, err := queryPrometheusValue(ctx, prom, cpuQuery)
 		if err != nil {
 			if !strings.Contains(err.Error(), "no data found") {
-				fmt.Printf("Prometheus CPU query failed for %s: %v. Query: %s\n", containerName, err, cpuQuery)
-			} else if isDebug {
-				fmt.Printf("Debug: No CPU data for %s. Query: %s\n", containerName, cpuQuery)
+				clog.Error("Prometheus CPU query failed", "error", err, "query", cpuQuery)
+			} else {
+				clog.Debug("No CPU data", "query", cpuQuery)
 			}
 			continue
 		}
 
-		maxMem, err := queryPrometheusValue(promURL, memQuery)
+		maxMem, err := queryPrometheusValue(ctx, prom, memQuery)
 		if err != nil {
 			if !strings.Contains(err.Error(), "no data found") {
-				fmt.Printf("Prometheus Memory query failed for %s: %v. Query: %s\n", containerName, err, memQuery)
-			} else if isDebug {
-				fmt.Printf("Debug: No Memory data for %s. Query: %s\n", containerName, memQuery)
+				clog.Error("Prometheus memory query failed", "error", err, "query", memQuery)
+			} else {
+				clog.Debug("No memory data", "query", memQuery)
 			}
 			continue
 		}
@@ -174,26 +194,36 @@ func GeneratePrometheusSuggestions(client dynamic.Interface, workload unstructur
 
 		// 6. Generate Suggestion
 		res := makeSuggestion(name, kind, containerName, idx, totalContainers, int64(len(podNames)), maxCpuNano, maxMemBytes, cMap, "Prometheus")
+		res.MemoryMetric = string(memMetric)
+		res.Window = rangeStr
+		res.Samples = int64(len(podNames))
 		results = append(results, res)
 	}
 
 	if len(results) == 0 {
-		if isDebug {
-			fmt.Printf("Debug: No suggestion results generated for %s/%s (Prometheus returned nil, falling back)\n", ns, name)
-		}
+		log.Debug("No suggestion results from Prometheus, falling back")
 		return nil
 	}
 	return results
 }
 
-func isPrometheusReachable(promURL string) bool {
+func isPrometheusReachable(ctx context.Context, prom PrometheusTarget) bool {
+	if err := promLimiter.Wait(ctx); err != nil {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(ctx, GetPrometheusTimeout())
+	defer cancel()
+
 	client := createHttpClient()
 	// Simple health check or just query API
-	resp, err := client.Get(fmt.Sprintf("%s/-/healthy", promURL))
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/-/healthy", prom.URL), nil)
 	if err != nil {
-		if os.Getenv("LOG_LEVEL") == "debug" {
-			fmt.Printf("Debug: Prometheus health check failed: %v\n", err)
-		}
+		return false
+	}
+	setTenant(req, prom)
+	resp, err := client.Do(req)
+	if err != nil {
+		slog.Debug("Prometheus health check failed", "url", prom.URL, "error", err)
 		return false
 	}
 	defer resp.Body.Close()
@@ -210,25 +240,42 @@ type PromQueryResponse struct {
 	} `json:"data"`
 }
 
-func queryPrometheusValue(promURL, query string) (float64, error) {
+func queryPrometheusValue(ctx context.Context, prom PrometheusTarget, query string) (float64, error) {
+	start := time.Now()
+	val, err := doPrometheusQuery(ctx, prom, query)
+	metrics.PrometheusQueryDuration.Observe(time.Since(start).Seconds())
+	if err != nil && !strings.Contains(err.Error(), "no data found") {
+		metrics.PrometheusQueryErrors.Inc()
+	}
+	return val, err
+}
+
+func doPrometheusQuery(ctx context.Context, prom PrometheusTarget, query string) (float64, error) {
+	if err := promLimiter.Wait(ctx); err != nil {
+		return 0, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, GetPrometheusTimeout())
+	defer cancel()
+
 	client := createHttpClient()
-	u, _ := url.Parse(fmt.Sprintf("%s/api/v1/query", promURL))
+	u, _ := url.Parse(fmt.Sprintf("%s/api/v1/query", prom.URL))
 	q := u.Query()
 	q.Set("query", query)
 	u.RawQuery = q.Encode()
 
-	req, err := http.NewRequest("GET", u.String(), nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
 	if err != nil {
 		return 0, err
 	}
+	setTenant(req, prom)
 
 	// Add Bearer Token if running in OpenShift mode
-	if os.Getenv("OPENSHIFT_ENABLED") == "true" {
+	if config.Get().Prometheus.OpenShift {
 		tokenBytes, err := os.ReadFile("/var/run/secrets/kubernetes.io/serviceaccount/token")
 		if err == nil {
 			req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", string(tokenBytes)))
 		} else {
-			fmt.Printf("Warning: Failed to read service account token: %v\n", err)
+			slog.Warn("Failed to read service account token", "error", err)
 		}
 	}
 
@@ -278,17 +325,27 @@ func queryPrometheusValue(promURL, query string) (float64, error) {
 	return val, nil
 }
 
+// setTenant adds the tenant header used by multi-tenant Prometheus backends
+func setTenant(req *http.Request, prom PrometheusTarget) {
+	if prom.Tenant != "" {
+		req.Header.Set("X-Scope-OrgID", prom.Tenant)
+	}
+}
+
 func createHttpClient() *http.Client {
 	// If OpenShift is enabled, we need to skip verify for internal HTTPS endpoints
 	// as standard Service/Route certs might be self-signed or internal CA.
-	if os.Getenv("OPENSHIFT_ENABLED") == "true" {
+	if config.Get().Prometheus.OpenShift {
 		tr := &http.Transport{
 			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
 		}
-		return &http.Client{
-			Transport: tr,
-			Timeout:   10 * time.Second,
-		}
+		return &http.Client{Transport: tr}
 	}
-	return &http.Client{Timeout: 10 * time.Second}
+	// Deadlines come from the request context (see GetPrometheusTimeout)
+	return &http.Client{}
+}
+
+// GetPrometheusTimeout returns the configured per-query deadline
+func GetPrometheusTimeout() time.Duration {
+	return config.Get().Prometheus.Timeout.Duration
 }
@@ -0,0 +1,204 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/joe-l-mathew/kube-resource-suggest/pkg/config"
+)
+
+// PrometheusSchema describes the metric and label names used to build PromQL queries.
+// Older clusters expose pod_name/container_name, and some stacks relabel them entirely.
+type PrometheusSchema struct {
+	CpuMetric          string
+	MemoryMetric       string
+	RssMetric          string
+	UsageMetric        string
+	InactiveFileMetric string
+	NamespaceLabel     string
+	PodLabel           string
+	ContainerLabel     string
+
+	// Optional full query overrides, rendered with QueryParams
+	CpuQueryTemplate    string
+	MemoryQueryTemplate string
+}
+
+// QueryParams are the values available to query templates.
+type QueryParams struct {
+	// Series is the selected series expression, e.g. metric{selector}.
+	// For the cache-aware memory metric it is an expression of three series.
+	Series    string
+	Metric    string
+	Namespace string
+	Container string
+	PodRegex  string
+	Range     string
+	// Selector is the rendered label matcher, e.g. namespace="a", container="b", pod=~"c"
+	Selector string
+}
+
+const (
+	defaultCpuQueryTemplate    = `max(max_over_time(rate({{.Series}}[5m])[{{.Range}}:1m]))`
+	defaultMemoryQueryTemplate = `max(max_over_time({{.Series}}[{{.Range}}:1m]))`
+)
+
+// GetPrometheusSchema returns the configured metric/label name mappings (cAdvisor names by default).
+func GetPrometheusSchema() PrometheusSchema {
+	s := config.Get().Prometheus.Schema
+	schema := PrometheusSchema{
+		CpuMetric:           s.CpuMetric,
+		MemoryMetric:        s.MemoryMetric,
+		RssMetric:           s.RssMetric,
+		UsageMetric:         s.UsageMetric,
+		InactiveFileMetric:  s.InactiveFileMetric,
+		NamespaceLabel:      s.NamespaceLabel,
+		PodLabel:            s.PodLabel,
+		ContainerLabel:      s.ContainerLabel,
+		CpuQueryTemplate:    s.CpuQuery,
+		MemoryQueryTemplate: s.MemoryQuery,
+	}
+	if schema.CpuQueryTemplate == "" {
+		schema.CpuQueryTemplate = defaultCpuQueryTemplate
+	}
+	if schema.MemoryQueryTemplate == "" {
+		schema.MemoryQueryTemplate = defaultMemoryQueryTemplate
+	}
+	return schema
+}
+
+// selector renders the label matchers for a single container across the given pods
+func (s PrometheusSchema) selector(ns, container, podRegex string) string {
+	return fmt.Sprintf("%s=\"%s\", %s=\"%s\", %s=~\"%s\"",
+		s.NamespaceLabel, ns, s.ContainerLabel, container, s.PodLabel, podRegex)
+}
+
+// CpuQuery builds the peak CPU query for a container
+func (s PrometheusSchema) CpuQuery(ns, container, podRegex, rangeStr string) (string, error) {
+	sel := s.selector(ns, container, podRegex)
+	return renderQuery(s.CpuQueryTemplate, QueryParams{
+		Series:    fmt.Sprintf("%s{%s}", s.CpuMetric, sel),
+		Metric:    s.CpuMetric,
+		Namespace: ns,
+		Container: container,
+		PodRegex:  podRegex,
+		Range:     rangeStr,
+		Selector:  sel,
+	})
+}
+
+// MemoryQuery builds the peak memory query for a container using the selected memory metric
+func (s PrometheusSchema) MemoryQuery(ns, container, podRegex, rangeStr string, metric MemoryMetric) (string, error) {
+	sel := s.selector(ns, container, podRegex)
+
+	var series, metricName string
+	switch metric {
+	case MemoryMetricRSS:
+		metricName = s.RssMetric
+		series = fmt.Sprintf("%s{%s}", metricName, sel)
+	case MemoryMetricCacheAware:
+		// max(usage - inactive file, rss), matched per container. Each side is reduced to one
+		// series per container first, since duplicate cAdvisor series break one-to-one matching
+		metricName = s.UsageMetric
+		labels := fmt.Sprintf("%s, %s, %s", s.NamespaceLabel, s.PodLabel, s.ContainerLabel)
+		perContainer := func(metric string) string {
+			return fmt.Sprintf("max by (%s) (%s{%s})", labels, metric, sel)
+		}
+		usage, inactive, rss := perContainer(s.UsageMetric), perContainer(s.InactiveFileMetric), perContainer(s.RssMetric)
+		on := fmt.Sprintf("on(%s)", labels)
+		series = fmt.Sprintf("((%s - %s %s) > %s %s or %s %s)", usage, on, inactive, on, rss, on, rss)
+	default:
+		metricName = s.MemoryMetric
+		series = fmt.Sprintf("%s{%s}", metricName, sel)
+	}
+
+	return renderQuery(s.MemoryQueryTemplate, QueryParams{
+		Series:    series,
+		Metric:    metricName,
+		Namespace: ns,
+		Container: container,
+		PodRegex:  podRegex,
+		Range:     rangeStr,
+		Selector:  sel,
+	})
+}
+
+func renderQuery(tmpl string, params QueryParams) (string, error) {
+	t, err := template.New("query").Option("missingkey=error").Parse(tmpl)
+	if err != nil {
+		return "", fmt.Errorf("invalid query template: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, params); err != nil {
+		return "", fmt.Errorf("failed to render query template: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// memoryMetrics are all memory metrics; any of them can be selected per workload by annotation
+var memoryMetrics = []MemoryMetric{MemoryMetricWorkingSet, MemoryMetricRSS, MemoryMetricCacheAware}
+
+// seriesFor returns the series a memory metric is computed from
+func (s PrometheusSchema) seriesFor(metric MemoryMetric) []string {
+	switch metric {
+	case MemoryMetricRSS:
+		return []string{s.RssMetric}
+	case MemoryMetricCacheAware:
+		return []string{s.UsageMetric, s.InactiveFileMetric, s.RssMetric}
+	}
+	return []string{s.MemoryMetric}
+}
+
+// ValidatePrometheusSchema checks that the configured series exist and carry the configured labels.
+// It is meant to be run once at startup so misconfigured mappings are caught early. Every memory
+// metric is checked, not only the default, since workloads can select another with MemoryMetricAnnotation.
+func ValidatePrometheusSchema(ctx context.Context, prom PrometheusTarget, schema PrometheusSchema) error {
+	var problems []string
+
+	// 1. Templates must at least render
+	if _, err := schema.CpuQuery("ns", "container", "pod", "1h"); err != nil {
+		problems = append(problems, fmt.Sprintf("cpu query: %v", err))
+	}
+	for _, m := range memoryMetrics {
+		if _, err := schema.MemoryQuery("ns", "container", "pod", "1h", m); err != nil {
+			problems = append(problems, fmt.Sprintf("memory query (%s): %v", m, err))
+		}
+	}
+
+	// 2. Series must exist with all three labels populated. Each series is checked once,
+	// and a missing one names the memory metrics that depend on it
+	metrics := []string{schema.CpuMetric}
+	usedBy := map[string][]string{schema.CpuMetric: {"cpu"}}
+	for _, m := range memoryMetrics {
+		for _, metric := range schema.seriesFor(m) {
+			if _, ok := usedBy[metric]; !ok {
+				metrics = append(metrics, metric)
+			}
+			use := "memory " + string(m)
+			if m == GetDefaultMemoryMetric() {
+				use += " (default)"
+			}
+			usedBy[metric] = append(usedBy[metric], use)
+		}
+	}
+	for _, metric := range metrics {
+		query := fmt.Sprintf("count(%s{%s!=\"\", %s!=\"\", %s!=\"\"})",
+			metric, schema.NamespaceLabel, schema.PodLabel, schema.ContainerLabel)
+		if _, err := queryPrometheusValue(ctx, prom, query); err != nil {
+			if strings.Contains(err.Error(), "no data found") {
+				problems = append(problems, fmt.Sprintf("no series %s with labels %s, %s, %s (used by %s)",
+					metric, schema.NamespaceLabel, schema.PodLabel, schema.ContainerLabel, strings.Join(usedBy[metric], ", ")))
+			} else {
+				problems = append(problems, fmt.Sprintf("query %q failed: %v", query, err))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("prometheus self-test failed: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
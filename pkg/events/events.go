@@ -0,0 +1,31 @@
+package events
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// Component is the event source reported in `kubectl describe`
+const Component = "krs-controller"
+
+// correlatorOptions deduplicate and rate-limit events per object: identical events only bump
+// a count, more than 5 similar ones within 10 minutes are combined into one, and each object
+// gets a burst of 10 events, then one every 5 minutes.
+var correlatorOptions = record.CorrelatorOptions{
+	MaxEvents:            5,
+	MaxIntervalInSeconds: 600,
+	BurstSize:            10,
+	QPS:                  1.0 / 300,
+}
+
+// NewRecorder returns an EventRecorder that writes Events through client.
+// Call the returned function on shutdown to flush pending events.
+func NewRecorder(client kubernetes.Interface) (record.EventRecorder, func()) {
+	broadcaster := record.NewBroadcaster(record.WithCorrelatorOptions(correlatorOptions))
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: client.CoreV1().Events("")})
+	recorder := broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: Component})
+	return recorder, broadcaster.Shutdown
+}
@@ -0,0 +1,143 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+)
+
+// apiCheckTimeout bounds the API-server round trip made by /readyz
+const apiCheckTimeout = 5 * time.Second
+
+// Checker tracks controller liveness and readiness
+type Checker struct {
+	mu           sync.RWMutex
+	coreClient   *kubernetes.Clientset
+	scanInterval time.Duration
+	maxMissed    int
+	leading      bool
+	lastScan     time.Time // last completed scan, or when leadership started
+	// leader is the current leader seen by a standby, empty until the election settled
+	leader string
+}
+
+// NewChecker returns a Checker that fails liveness after maxMissed scan intervals without a completed scan
+func NewChecker(coreClient *kubernetes.Clientset, scanInterval time.Duration, maxMissed int) *Checker {
+	return &Checker{
+		coreClient:   coreClient,
+		scanInterval: scanInterval,
+		maxMissed:    maxMissed,
+	}
+}
+
+// SetScanPolicy updates the scan interval and missed-scan allowance after a config reload
+func (c *Checker) SetScanPolicy(scanInterval time.Duration, maxMissed int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.scanInterval = scanInterval
+	c.maxMissed = maxMissed
+}
+
+// ScanCompleted records a finished scan
+func (c *Checker) ScanCompleted() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastScan = time.Now()
+}
+
+// SetLeading marks whether this replica runs the scan loop. Standbys are always live.
+func (c *Checker) SetLeading(leading bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.leading = leading
+	if leading {
+		// Give the first scan a full allowance
+		c.lastScan = time.Now()
+	}
+}
+
+// SetLeader records the leader seen by leader election, which makes a standby ready
+func (c *Checker) SetLeader(identity string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.leader = identity
+}
+
+// Healthz fails if the leader has not finished a scan within maxMissed intervals
+func (c *Checker) Healthz(w http.ResponseWriter, r *http.Request) {
+	c.mu.RLock()
+	leading, lastScan := c.leading, c.lastScan
+	allowed := time.Duration(c.maxMissed) * c.scanInterval
+	c.mu.RUnlock()
+
+	if leading {
+		if since := time.Since(lastScan); since > allowed {
+			http.Error(w, fmt.Sprintf("no scan completed in %s (allowed %s)", since.Round(time.Second), allowed), http.StatusServiceUnavailable)
+			return
+		}
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+// Readyz requires this replica to be the leader or a standby that sees one, and a working
+// API-server connection
+func (c *Checker) Readyz(w http.ResponseWriter, r *http.Request) {
+	c.mu.RLock()
+	leading, leader := c.leading, c.leader
+	c.mu.RUnlock()
+
+	if !leading && leader == "" {
+		http.Error(w, "waiting for leader election", http.StatusServiceUnavailable)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), apiCheckTimeout)
+	defer cancel()
+	if err := c.coreClient.RESTClient().Get().AbsPath("/readyz").Do(ctx).Error(); err != nil {
+		http.Error(w, fmt.Sprintf("api server unreachable: %v", err), http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+// NewServeMux registers the probe endpoints and, if enabled, /debug/pprof
+func NewServeMux(c *Checker, enablePprof bool) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", c.Healthz)
+	mux.HandleFunc("/readyz", c.Readyz)
+
+	if enablePprof {
+		mux.HandleFunc("/debug/pprof/", pprof.Index)
+		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	}
+	return mux
+}
+
+// Serve runs an HTTP server on addr until ctx is cancelled
+func Serve(ctx context.Context, addr string, handler http.Handler) error {
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package leader
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/joe-l-mathew/kube-resource-suggest/pkg/config"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// Lease timings: a crashed leader is replaced within LeaseDuration, a healthy one renews every RetryPeriod.
+const (
+	leaseDuration = 15 * time.Second
+	renewDeadline = 10 * time.Second
+	retryPeriod   = 2 * time.Second
+)
+
+// Config holds the leader election settings
+type Config struct {
+	Enabled   bool
+	LeaseName string
+	Namespace string
+	Identity  string
+}
+
+// GetConfig returns leader election settings from the configuration; the identity is the pod name
+func GetConfig() Config {
+	le := config.Get().LeaderElection
+	cfg := Config{
+		Enabled:   le.Enabled,
+		LeaseName: le.LeaseName,
+		Namespace: le.Namespace,
+		Identity:  os.Getenv("POD_NAME"),
+	}
+
+	if cfg.Namespace == "" {
+		cfg.Namespace = currentNamespace()
+	}
+	if cfg.Identity == "" {
+		cfg.Identity, _ = os.Hostname()
+	}
+	return cfg
+}
+
+// currentNamespace returns the namespace the controller runs in, or "default" outside a cluster
+func currentNamespace() string {
+	if ns := os.Getenv("POD_NAMESPACE"); ns != "" {
+		return ns
+	}
+	data, err := os.ReadFile("/var/run/secrets/kubernetes.io/serviceaccount/namespace")
+	if err == nil {
+		if ns := strings.TrimSpace(string(data)); ns != "" {
+			return ns
+		}
+	}
+	return "default"
+}
+
+// Run blocks and calls run only while this replica holds the Lease, and observe with the identity
+// of every new leader. If election is disabled, run is called directly. When ctx is cancelled, run's
+// context is cancelled too, and the Lease is only released once run has returned.
+func Run(ctx context.Context, coreClient *kubernetes.Clientset, cfg Config, run func(ctx context.Context), observe func(identity string)) error {
+	if !cfg.Enabled {
+		run(ctx)
+		return nil
+	}
+
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{
+			Name:      cfg.LeaseName,
+			Namespace: cfg.Namespace,
+		},
+		Client: coreClient.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{
+			Identity: cfg.Identity,
+		},
+	}
+
+	// The elector gets its own context so the Lease outlives ctx while in-flight work drains
+	electorCtx, cancelElector := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelElector()
+	runDone := make(chan struct{})
+
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		LeaseDuration:   leaseDuration,
+		RenewDeadline:   renewDeadline,
+		RetryPeriod:     retryPeriod,
+		ReleaseOnCancel: true,
+		Name:            cfg.LeaseName,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(leaderCtx context.Context) {
+				defer close(runDone)
+				runCtx, cancel := context.WithCancel(leaderCtx)
+				defer cancel()
+				stop := context.AfterFunc(ctx, cancel)
+				defer stop()
+				run(runCtx)
+			},
+			OnStoppedLeading: func() {
+				slog.Info("Stopped leading", "identity", cfg.Identity)
+			},
+			OnNewLeader: func(identity string) {
+				observe(identity)
+				if identity != cfg.Identity {
+					slog.Info("Standing by", "leader", identity)
+				}
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create leader elector: %w", err)
+	}
+
+	// On shutdown, release the Lease right away if standing by, or after run returns if leading
+	go func() {
+		select {
+		case <-ctx.Done():
+			if elector.IsLeader() {
+				<-runDone
+			}
+			cancelElector()
+		case <-electorCtx.Done():
+		}
+	}()
+
+	slog.Info("Leader election enabled", "lease", cfg.LeaseName, "namespace", cfg.Namespace, "identity", cfg.Identity)
+	elector.Run(electorCtx)
+
+	// Run only returns once leadership is lost or ctx is cancelled
+	if ctx.Err() == nil {
+		return fmt.Errorf("lost leadership of lease %s/%s", cfg.Namespace, cfg.LeaseName)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// level is shared by the default logger so it can be changed at runtime
+var level = new(slog.LevelVar)
+
+// Setup installs the default structured logger. format is "text" or "json".
+func Setup(levelStr, format string) error {
+	if err := SetLevel(levelStr); err != nil {
+		return err
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch strings.ToLower(format) {
+	case "", "text":
+		handler = slog.NewTextHandler(os.Stdout, opts)
+	case "json":
+		handler = slog.NewJSONHandler(os.Stdout, opts)
+	default:
+		return fmt.Errorf("unknown log format %q (expected text or json)", format)
+	}
+
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// ParseLevel accepts debug, info, warn (or warning) and error
+func ParseLevel(s string) (slog.Level, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return slog.LevelInfo, fmt.Errorf("unknown log level %q (expected debug, info, warn or error)", s)
+}
+
+// SetLevel changes the level of the default logger
+func SetLevel(s string) error {
+	l, err := ParseLevel(s)
+	if err != nil {
+		return err
+	}
+	if l != level.Level() {
+		level.Set(l)
+		slog.Info("Log level changed", "level", strings.ToLower(l.String()))
+	}
+	return nil
+}
+
+// Level returns the current level name
+func Level() string {
+	return strings.ToLower(level.Level().String())
+}
+
+// LevelHandler serves the current level on GET and changes it on PUT (body: level name)
+// while writable returns true. The endpoint is unauthenticated, so writes are opt-in.
+func LevelHandler(writable func() bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut, http.MethodPost:
+			if !writable() {
+				http.Error(w, "changing the log level is disabled (logging.allowLevelChange)", http.StatusForbidden)
+				return
+			}
+			body, err := io.ReadAll(io.LimitReader(r.Body, 64))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := SetLevel(string(body)); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		fmt.Fprintln(w, Level())
+	})
+}
+
+// Fatal logs at error level and exits
+func Fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
@@ -0,0 +1,263 @@
+package metrics
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "krs"
+
+// Labels identifying a single container suggestion (cluster is empty in single-cluster mode)
+var containerLabels = []string{"cluster", "namespace", "workload", "kind", "container"}
+
+// --- Recommendation Gauges ---
+
+var (
+	cpuCurrent = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "cpu_current_cores",
+		Help:      "Current CPU request/limit of a container in cores (0 if not set).",
+	}, append(containerLabels, "type"))
+
+	cpuRecommended = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "cpu_recommended_cores",
+		Help:      "Recommended CPU request/limit of a container in cores.",
+	}, append(containerLabels, "type"))
+
+	memoryCurrent = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "memory_current_bytes",
+		Help:      "Current memory request/limit of a container in bytes (0 if not set).",
+	}, append(containerLabels, "type"))
+
+	memoryRecommended = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "memory_recommended_bytes",
+		Help:      "Recommended memory request/limit of a container in bytes.",
+	}, append(containerLabels, "type"))
+
+	suggestionInfo = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "suggestion_info",
+		Help:      "Always 1; carries the status and source of the current suggestion.",
+	}, append(containerLabels, "status", "source"))
+)
+
+// --- Controller Metrics ---
+
+var (
+	ScanDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "scan_duration_seconds",
+		Help:      "Duration of full cluster scans.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 14), // 1s .. ~2h
+	})
+
+	ScanLag = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "scan_lag_seconds",
+		Help:      "How much longer the last scan took than the scan interval (0 if on time).",
+	})
+
+	LastScanTimestamp = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_scan_timestamp_seconds",
+		Help:      "Unix time the last scan completed.",
+	})
+
+	WorkloadsProcessed = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "workloads_processed_total",
+		Help:      "Workloads analysed.",
+	})
+
+	PrometheusQueryErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "prometheus_query_errors_total",
+		Help:      "Prometheus queries that failed (excluding queries with no data).",
+	})
+
+	PrometheusQueryDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "prometheus_query_duration_seconds",
+		Help:      "Latency of Prometheus queries.",
+		Buckets:   prometheus.DefBuckets,
+	})
+
+	KubeletFallbacks = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "kubelet_fallback_total",
+		Help:      "Workloads for which Prometheus had no answer and the Kubelet was used.",
+	})
+
+	MetricsServerFallbacks = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "metrics_server_fallback_total",
+		Help:      "Workloads for which Prometheus had no answer and metrics-server was used.",
+	})
+
+	SuggestionWrites = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "suggestion_writes_total",
+		Help:      "ResourceSuggestion writes by operation (apply, status, report).",
+	}, []string{"operation"})
+
+	ClusterScanErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cluster_scan_errors_total",
+		Help:      "Scans of a cluster that failed to list its workloads.",
+	}, []string{"cluster"})
+
+	OrphanedSuggestions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "orphaned_suggestions_total",
+		Help:      "Suggestions for removed containers or workloads, by action (delete, mark), and renamed ones (migrate).",
+	}, []string{"cluster", "action"})
+
+	ListErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "list_errors_total",
+		Help:      "Workload resource types that failed to list during a scan.",
+	}, []string{"cluster", "resource"})
+
+	WorkloadsDiscovered = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "workloads_discovered",
+		Help:      "Workloads found by the last scan, per resource type.",
+	}, []string{"cluster", "resource"})
+
+	ScanSuccess = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "scan_success",
+		Help:      "1 if the last scan listed every resource type, 0 if it partially or fully failed.",
+	}, []string{"cluster"})
+
+	AutoApply = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "auto_apply_total",
+		Help:      "Auto-apply decisions for opted-in workloads, by outcome (AutoApplied, or why it was skipped or failed).",
+	}, []string{"cluster", "outcome"})
+
+	WebhookRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_requests_total",
+		Help:      "Pod admission requests handled by the webhook, by outcome (injected, unchanged, skipped or error).",
+	}, []string{"outcome"})
+)
+
+// --- Recommendation Tracking ---
+
+// ContainerKey identifies the container a suggestion belongs to
+type ContainerKey struct {
+	Cluster, Namespace, Workload, Kind, Container string
+}
+
+// Resources are CPU (nanocores) and memory (bytes) requests and limits
+type Resources struct {
+	CpuRequestNano     int64
+	CpuLimitNano       int64
+	MemoryRequestBytes int64
+	MemoryLimitBytes   int64
+}
+
+type trackedSuggestion struct {
+	status, source string
+	scan           uint64
+}
+
+var (
+	mu      sync.Mutex
+	scanGen uint64
+	tracked = map[ContainerKey]trackedSuggestion{}
+)
+
+// BeginScan starts a new scan generation; series not recorded before EndScan are removed
+func BeginScan() {
+	mu.Lock()
+	defer mu.Unlock()
+	scanGen++
+}
+
+// EndScan removes recommendation series for containers that were not seen in this scan.
+// Series of keepClusters (clusters whose scan failed) are left untouched.
+func EndScan(keepClusters ...string) {
+	mu.Lock()
+	defer mu.Unlock()
+	for key, t := range tracked {
+		if t.scan != scanGen && !slices.Contains(keepClusters, key.Cluster) {
+			deleteSeries(key)
+			delete(tracked, key)
+		}
+	}
+}
+
+// RecordSuggestion exports the current and recommended values of a suggestion
+func RecordSuggestion(key ContainerKey, status, source string, current, recommended Resources) {
+	labels := func(extra ...string) []string {
+		return append([]string{key.Cluster, key.Namespace, key.Workload, key.Kind, key.Container}, extra...)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	// Drop the previous info series if status or source changed
+	if prev, ok := tracked[key]; ok && (prev.status != status || prev.source != source) {
+		suggestionInfo.DeleteLabelValues(labels(prev.status, prev.source)...)
+	}
+	tracked[key] = trackedSuggestion{status: status, source: source, scan: scanGen}
+
+	cpuCurrent.WithLabelValues(labels("request")...).Set(float64(current.CpuRequestNano) / 1e9)
+	cpuCurrent.WithLabelValues(labels("limit")...).Set(float64(current.CpuLimitNano) / 1e9)
+	cpuRecommended.WithLabelValues(labels("request")...).Set(float64(recommended.CpuRequestNano) / 1e9)
+	cpuRecommended.WithLabelValues(labels("limit")...).Set(float64(recommended.CpuLimitNano) / 1e9)
+
+	memoryCurrent.WithLabelValues(labels("request")...).Set(float64(current.MemoryRequestBytes))
+	memoryCurrent.WithLabelValues(labels("limit")...).Set(float64(current.MemoryLimitBytes))
+	memoryRecommended.WithLabelValues(labels("request")...).Set(float64(recommended.MemoryRequestBytes))
+	memoryRecommended.WithLabelValues(labels("limit")...).Set(float64(recommended.MemoryLimitBytes))
+
+	suggestionInfo.WithLabelValues(labels(status, source)...).Set(1)
+}
+
+// RecordListResult exports the outcome of listing a cluster's workloads.
+// counts and errs are keyed by resource type.
+func RecordListResult(cluster string, counts map[string]int, errs map[string]error) {
+	for resource, n := range counts {
+		WorkloadsDiscovered.WithLabelValues(cluster, resource).Set(float64(n))
+	}
+	for resource := range errs {
+		ListErrors.WithLabelValues(cluster, resource).Inc()
+	}
+	if len(errs) > 0 {
+		ScanSuccess.WithLabelValues(cluster).Set(0)
+	} else {
+		ScanSuccess.WithLabelValues(cluster).Set(1)
+	}
+}
+
+// ObserveScan records a completed scan and how far it overran the interval
+func ObserveScan(duration, interval time.Duration) {
+	ScanDuration.Observe(duration.Seconds())
+	ScanLag.Set(max(duration-interval, 0).Seconds())
+	LastScanTimestamp.SetToCurrentTime()
+}
+
+func deleteSeries(key ContainerKey) {
+	match := prometheus.Labels{
+		"cluster":   key.Cluster,
+		"namespace": key.Namespace,
+		"workload":  key.Workload,
+		"kind":      key.Kind,
+		"container": key.Container,
+	}
+	cpuCurrent.DeletePartialMatch(match)
+	cpuRecommended.DeletePartialMatch(match)
+	memoryCurrent.DeletePartialMatch(match)
+	memoryRecommended.DeletePartialMatch(match)
+	suggestionInfo.DeletePartialMatch(match)
+}
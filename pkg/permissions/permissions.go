@@ -0,0 +1,150 @@
+package permissions
+
+import (
+	"context"
+	"fmt"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/joe-l-mathew/kube-resource-suggest/pkg/config"
+)
+
+// Requirement is one API permission the controller needs
+type Requirement struct {
+	Verb        string
+	Group       string
+	Resource    string
+	Subresource string
+	// Namespace is empty for cluster-wide access
+	Namespace string
+	// Why says what does not work without it
+	Why string
+}
+
+func (r Requirement) String() string {
+	res := r.Resource
+	if r.Group != "" {
+		res = r.Group + "/" + res
+	}
+	if r.Subresource != "" {
+		res += "/" + r.Subresource
+	}
+	scope := "cluster-wide"
+	if r.Namespace != "" {
+		scope = "in namespace " + r.Namespace
+	}
+	return fmt.Sprintf("%s %s %s", r.Verb, res, scope)
+}
+
+// Required lists the permissions needed to scan and report with cfg
+func Required(cfg *config.Config) []Requirement {
+	var reqs []Requirement
+	add := func(verb, group, resource, subresource, ns, why string) {
+		reqs = append(reqs, Requirement{verb, group, resource, subresource, ns, why})
+	}
+
+	namespaces := cfg.WatchNamespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+
+	for _, ns := range namespaces {
+		// 1. Read Workloads
+		for _, r := range []string{"deployments", "statefulsets", "daemonsets"} {
+			add("list", "apps", r, "", ns, "scanning workloads")
+		}
+		add("list", "", "pods", "", ns, "finding a workload's pods")
+
+		// 2. Manage Custom Resources (written to the hub instead when it is enabled)
+		if !cfg.Hub.Enabled {
+			for _, verb := range []string{"patch", "create"} {
+				add(verb, "suggester.krs.io", "resourcesuggestions", "", ns, "writing suggestions")
+			}
+			add("patch", "suggester.krs.io", "resourcesuggestions", "status", ns, "writing suggestion status")
+			add("list", "suggester.krs.io", "resourcesuggestions", "", ns, "finding orphaned or renamed suggestions")
+			add("delete", "suggester.krs.io", "resourcesuggestions", "", ns, "removing orphaned or renamed suggestions")
+			if cfg.Reports.Enabled {
+				for _, verb := range []string{"patch", "create", "list", "delete"} {
+					add(verb, "suggester.krs.io", "resourcesuggestionreports", "", ns, "namespace reports")
+				}
+			}
+		}
+
+		add("create", "", "events", "", ns, "suggestion change events on workloads")
+
+		if cfg.AutoApply.Enabled {
+			for _, r := range []string{"deployments", "statefulsets", "daemonsets"} {
+				add("patch", "apps", r, "", ns, "auto-apply")
+			}
+			add("list", "policy", "poddisruptionbudgets", "", ns, "auto-apply PodDisruptionBudget checks")
+			if cfg.AutoApply.Mode == config.ApplyInPlace {
+				add("patch", "", "pods", "resize", ns, "in-place pod resize")
+				add("get", "", "pods", "", ns, "in-place resize status")
+			}
+		}
+
+		if cfg.FallbackSource() == config.FallbackMetricsServer {
+			add("list", "metrics.k8s.io", "pods", "", ns, "metrics-server fallback")
+		}
+	}
+
+	if cfg.Reports.Enabled && len(cfg.WatchNamespaces) == 0 && !cfg.Hub.Enabled {
+		for _, verb := range []string{"patch", "create"} {
+			add(verb, "suggester.krs.io", "clusterresourcesuggestionreports", "", "", "cluster report")
+		}
+	}
+
+	if cfg.AutoApply.Enabled && !cfg.NamespaceScoped() {
+		add("get", "", "namespaces", "", "", "auto-apply opt-in by namespace annotation")
+	}
+
+	if cfg.FallbackSource() == config.FallbackKubelet {
+		add("get", "", "nodes", "proxy", "", "Kubelet fallback")
+	}
+	return reqs
+}
+
+// LeaderElection lists the permissions needed to hold a Lease in namespace
+func LeaderElection(namespace string) []Requirement {
+	var reqs []Requirement
+	for _, verb := range []string{"get", "create", "update"} {
+		reqs = append(reqs, Requirement{verb, "coordination.k8s.io", "leases", "", namespace, "leader election"})
+	}
+	return reqs
+}
+
+// ControllerStatus lists the permissions needed to report scan status on the controller Pod in namespace
+func ControllerStatus(namespace string) []Requirement {
+	return []Requirement{
+		{"create", "", "events", "", namespace, "scan status events"},
+		{"patch", "", "pods", "status", namespace, "scan status condition"},
+	}
+}
+
+// Check asks the API server which requirements the controller's identity lacks
+func Check(ctx context.Context, client kubernetes.Interface, reqs []Requirement) ([]Requirement, error) {
+	var missing []Requirement
+	for _, r := range reqs {
+		review := &authorizationv1.SelfSubjectAccessReview{
+			Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+				ResourceAttributes: &authorizationv1.ResourceAttributes{
+					Namespace:   r.Namespace,
+					Verb:        r.Verb,
+					Group:       r.Group,
+					Resource:    r.Resource,
+					Subresource: r.Subresource,
+				},
+			},
+		}
+		res, err := client.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, review, metav1.CreateOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("access review for %s failed: %w", r, err)
+		}
+		if !res.Status.Allowed {
+			missing = append(missing, r)
+		}
+	}
+	return missing, nil
+}
@@ -0,0 +1,132 @@
+package reporter
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/joe-l-mathew/kube-resource-suggest/pkg/engine"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/util/csaupgrade"
+)
+
+// appliedTTL bounds how long a cached apply is trusted. After that the suggestion is
+// re-applied even if unchanged, which recreates CRs that were deleted by hand.
+const appliedTTL = 6 * time.Hour
+
+// statusRefresh is how often an unchanged status is rewritten to bump lastUpdated
+const statusRefresh = time.Hour
+
+// appliedState is the last object applied for a suggestion, the resulting resourceVersion
+// and the status last written (to keep condition transition times and the history)
+type appliedState struct {
+	object          string
+	resourceVersion string
+	conditions      []metav1.Condition
+	// spec is the last applied spec, kept after expiry to detect status changes
+	spec    map[string]interface{}
+	history []HistoryEntry
+	// published is the hysteresis state of the recommendation
+	published *engine.Published
+	// status is the last written status without lastUpdated, and statusAt when it was written
+	status   string
+	statusAt time.Time
+	at       time.Time
+}
+
+// applied caches appliedState by cluster/namespace/name, shared by all workers
+var applied sync.Map
+
+func lookupApplied(key string) (appliedState, bool) {
+	v, ok := applied.Load(key)
+	if !ok {
+		return appliedState{}, false
+	}
+	state := v.(appliedState)
+	if time.Since(state.at) > appliedTTL {
+		state.object = "" // Forces a re-apply; the rest is still what we last wrote
+	}
+	return state, true
+}
+
+func storeApplied(key string, state appliedState) {
+	state.at = time.Now()
+	applied.Store(key, state)
+}
+
+func forgetApplied(key string) {
+	applied.Delete(key)
+}
+
+// legacyFieldManagers wrote suggestions with Update before server-side apply: the default manager
+// name of the controller binary's user agent
+var legacyFieldManagers = sets.New("controller")
+
+// loadPrevious reads what is published for a suggestion when it is not cached, e.g. after a restart.
+// A suggestion that does not exist yet returns an empty state. Fields still owned by a legacy
+// manager are moved to FieldManager first, so the next apply prunes the ones KRS no longer sets.
+func loadPrevious(ctx context.Context, client dynamic.Interface, ns, name string) (appliedState, error) {
+	existing, err := client.Resource(suggestionGVR).Namespace(ns).Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return appliedState{}, nil
+	}
+	if err != nil {
+		return appliedState{}, err
+	}
+	if err := upgradeManagedFields(ctx, client, existing); err != nil {
+		// Not fatal: the apply still works, stale fields are only pruned once this succeeds
+		slog.Warn("Failed to migrate managed fields of suggestion", "namespace", ns, "name", name, "error", err)
+	}
+	return previousState(existing), nil
+}
+
+// previousState restores the state of a published suggestion, including its hysteresis state
+func previousState(existing *unstructured.Unstructured) appliedState {
+	spec, _, _ := unstructured.NestedMap(existing.Object, "spec")
+	status := statusFrom(existing)
+	state := appliedState{spec: spec, conditions: status.Conditions, history: status.History}
+
+	// The recommended values are in the latest history entry; the requests they were
+	// computed against are not stored, so a change of those is not detected this once
+	if n := len(status.History); n > 0 {
+		last := status.History[n-1]
+		cpuReq, err1 := resource.ParseQuantity(last.CpuRequest)
+		cpuLim, err2 := resource.ParseQuantity(last.CpuLimit)
+		memReq, err3 := resource.ParseQuantity(last.MemoryRequest)
+		memLim, err4 := resource.ParseQuantity(last.MemoryLimit)
+		if err1 == nil && err2 == nil && err3 == nil && err4 == nil {
+			specStatus, _ := spec["status"].(string)
+			state.published = &engine.Published{
+				TargetCpuRequestNano:     cpuReq.ScaledValue(resource.Nano),
+				TargetCpuLimitNano:       cpuLim.ScaledValue(resource.Nano),
+				TargetMemoryRequestBytes: memReq.Value(),
+				TargetMemoryLimitBytes:   memLim.Value(),
+				Status:                   specStatus,
+			}
+		}
+	}
+	return state
+}
+
+// upgradeManagedFields hands the fields of existing owned by legacyFieldManagers to FieldManager.
+// Nothing is written once that is done. A conflict means the suggestion changed since it was read;
+// it is retried the next time the suggestion is read.
+func upgradeManagedFields(ctx context.Context, client dynamic.Interface, existing *unstructured.Unstructured) error {
+	patch, err := csaupgrade.UpgradeManagedFieldsPatch(existing, legacyFieldManagers, FieldManager)
+	if err != nil || patch == nil {
+		return err
+	}
+	_, err = client.Resource(suggestionGVR).Namespace(existing.GetNamespace()).Patch(ctx, existing.GetName(), types.JSONPatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to migrate managed fields: %v", err)
+	}
+	return nil
+}
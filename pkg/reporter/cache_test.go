@@ -0,0 +1,90 @@
+package reporter
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/joe-l-mathew/kube-resource-suggest/pkg/engine"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// publishedSuggestion returns a suggestion as stored, with spec.status and status.history
+func publishedSuggestion(t *testing.T, status string, history ...HistoryEntry) *unstructured.Unstructured {
+	t.Helper()
+	data, err := json.Marshal(suggestionStatus{History: history})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		t.Fatal(err)
+	}
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec":   map[string]interface{}{"status": status},
+		"status": raw,
+	}}
+}
+
+func TestPreviousState(t *testing.T) {
+	const mi = 1024 * 1024
+	old := HistoryEntry{CpuRequest: "1", CpuLimit: "2", MemoryRequest: "1Gi", MemoryLimit: "2Gi"}
+	last := HistoryEntry{CpuRequest: "250m", CpuLimit: "0", MemoryRequest: "256Mi", MemoryLimit: "512Mi"}
+
+	tests := []struct {
+		name     string
+		existing *unstructured.Unstructured
+		want     *engine.Published
+	}{
+		{
+			name:     "no history",
+			existing: publishedSuggestion(t, "Optimal"),
+		},
+		{
+			name:     "latest history entry with the spec's status",
+			existing: publishedSuggestion(t, "Overprovisioned", old, last),
+			want: &engine.Published{
+				TargetCpuRequestNano:     250e6,
+				TargetMemoryRequestBytes: 256 * mi,
+				TargetMemoryLimitBytes:   512 * mi,
+				Status:                   "Overprovisioned",
+			},
+		},
+		{
+			name:     "invalid history entry",
+			existing: publishedSuggestion(t, "Overprovisioned", HistoryEntry{CpuRequest: "a lot", CpuLimit: "0", MemoryRequest: "0", MemoryLimit: "0"}),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := previousState(tt.existing).published; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("previousState().published = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// A recommendation restored after a restart has exactly the values it was written with
+func TestPreviousStateRoundTrip(t *testing.T) {
+	s := &engine.SuggestionResult{
+		Status:                   "Overprovisioned",
+		TargetCpuRequestNano:     333333333,
+		TargetCpuLimitNano:       666666666,
+		TargetMemoryRequestBytes: 300 * 1024 * 1024,
+		TargetMemoryLimitBytes:   600 * 1024 * 1024,
+	}
+	existing := publishedSuggestion(t, s.Status, historyEntry(s, metav1.Now()))
+
+	got := previousState(existing).published
+	want := &engine.Published{
+		TargetCpuRequestNano:     s.TargetCpuRequestNano,
+		TargetCpuLimitNano:       s.TargetCpuLimitNano,
+		TargetMemoryRequestBytes: s.TargetMemoryRequestBytes,
+		TargetMemoryLimitBytes:   s.TargetMemoryLimitBytes,
+		Status:                   s.Status,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("restored %+v, want %+v", got, want)
+	}
+}
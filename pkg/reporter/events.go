@@ -0,0 +1,55 @@
+package reporter
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Event reasons recorded on a workload when a container's suggestion status changes.
+// They are part of the interface: alerting tools match on them.
+const (
+	EventReasonUnderprovisioned = "SuggestionUnderprovisioned"
+	EventReasonOverprovisioned  = "SuggestionOverprovisioned"
+	EventReasonOptimal          = "SuggestionOptimal"
+	EventReasonStatusChanged    = "SuggestionStatusChanged"
+)
+
+// eventReason maps a suggestion status to its event type and reason
+func eventReason(status string) (string, string) {
+	switch status {
+	case "Underprovisioned":
+		return corev1.EventTypeWarning, EventReasonUnderprovisioned
+	case "Overprovisioned":
+		return corev1.EventTypeNormal, EventReasonOverprovisioned
+	case "Optimal":
+		return corev1.EventTypeNormal, EventReasonOptimal
+	}
+	return corev1.EventTypeNormal, EventReasonStatusChanged
+}
+
+// recordStatusChange records an Event on the workload if the suggestion status changed.
+// Repeats are aggregated and rate-limited by the recorder (see pkg/events).
+func recordStatusChange(target Target, workload *unstructured.Unstructured, previous, current map[string]interface{}) {
+	if target.Recorder == nil || previous == nil {
+		return
+	}
+	oldStatus, _ := previous["status"].(string)
+	newStatus, _ := current["status"].(string)
+	if oldStatus == "" || oldStatus == newStatus {
+		return
+	}
+
+	eventType, reason := eventReason(newStatus)
+	message := fmt.Sprintf("Container %s: %s -> %s.", current["containerName"], oldStatus, newStatus)
+	for _, f := range []struct{ key, label string }{
+		{"cpuRequest", "CPU request"},
+		{"cpuLimit", "CPU limit"},
+		{"memoryRequest", "memory request"},
+		{"memoryLimit", "memory limit"},
+	} {
+		message += fmt.Sprintf(" %s %v (was %v);", f.label, current[f.key], previous[f.key])
+	}
+	target.Recorder.Event(workload, eventType, reason, message[:len(message)-1])
+}
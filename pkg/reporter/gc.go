@@ -0,0 +1,240 @@
+package reporter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/joe-l-mathew/kube-resource-suggest/pkg/config"
+	"github.com/joe-l-mathew/kube-resource-suggest/pkg/metrics"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/dynamic"
+)
+
+// ReasonOrphaned marks a suggestion whose container or workload no longer exists
+const ReasonOrphaned = "Orphaned"
+
+// Scope is what a scan covered: the watched namespaces (all if empty) except the ignored ones
+type Scope struct {
+	WatchNamespaces   []string
+	IgnoredNamespaces []string
+}
+
+// covers reports whether the workloads of namespace ns were scanned
+func (s Scope) covers(ns string) bool {
+	if slices.Contains(s.IgnoredNamespaces, ns) {
+		return false
+	}
+	return len(s.WatchNamespaces) == 0 || slices.Contains(s.WatchNamespaces, ns)
+}
+
+// CollectGarbage deletes or marks (per mode) suggestions that no longer match a container of
+// the scanned workloads: removed or renamed containers and workloads that are gone. It also
+// migrates suggestions written under the old positional names, once the new one exists.
+// Only suggestions KRS wrote for target's cluster are considered. Those of workloads in namespaces
+// outside scope are at most marked, since their workloads may still exist.
+// workloads must be the complete result of a scan of scope, otherwise live suggestions would be
+// treated as orphans. Returns the number of suggestions acted on.
+func CollectGarbage(ctx context.Context, client dynamic.Interface, target Target, scope Scope, workloads []unstructured.Unstructured, mode string) (int, error) {
+	// 1. Expected suggestion name per container, per workload UID
+	expected := make(map[string]map[string]string, len(workloads))
+	for _, w := range workloads {
+		names := make(map[string]string)
+		for _, container := range containerNames(w) {
+			names[container], _ = suggestionName(target, w.GetNamespace(), w.GetName(), w.GetKind(), container)
+		}
+		expected[string(w.GetUID())] = names
+	}
+
+	// 2. Suggestions written for this cluster, in the namespaces that were scanned
+	namespaces := scope.WatchNamespaces
+	selector := labels.Everything().String()
+	if target.HubNamespace != "" {
+		namespaces = []string{target.HubNamespace}
+		selector = labels.Set{ClusterLabel: target.Cluster}.String()
+	} else if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+
+	acted := 0
+	var errs []error
+	for _, ns := range namespaces {
+		suggestions, err := listSuggestions(ctx, client, ns, selector)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		existing := make(map[string]bool, len(suggestions))
+		for _, s := range suggestions {
+			existing[s.GetNamespace()+"/"+s.GetName()] = true
+		}
+
+		for _, s := range suggestions {
+			action, message := mode, orphanedMessage
+			switch classify(s, target, scope, expected, existing) {
+			case keep:
+				continue
+			case migrate:
+				// The suggestion lives on under its new name, whatever the mode
+				action = gcMigrate
+			case unscanned:
+				// The workload may still exist: never delete it
+				if action == config.GCDelete {
+					action = config.GCMark
+				}
+				message = unscannedMessage
+			}
+			if action == config.GCOff {
+				continue
+			}
+			done, err := collect(ctx, client, target, s, action, message)
+			if err != nil {
+				errs = append(errs, err)
+			} else if done {
+				acted++
+			}
+		}
+	}
+	return acted, errors.Join(errs...)
+}
+
+// gcMigrate deletes a suggestion that was replaced by its new name
+const gcMigrate = "migrate"
+
+// gcAction is what to do with a listed suggestion
+type gcAction int
+
+const (
+	keep gcAction = iota
+	orphan
+	migrate
+	// unscanned suggestions belong to a namespace the scan did not cover
+	unscanned
+)
+
+// Messages of the Stale condition set on marked suggestions
+const (
+	orphanedMessage  = "The container or workload this suggestion was computed for no longer exists"
+	unscannedMessage = "The namespace of this suggestion's workload is no longer scanned"
+)
+
+// classify decides whether s still matches a container of a scanned workload. Suggestions that
+// KRS did not write for target's cluster, or that we cannot attribute to a workload, are kept.
+func classify(s unstructured.Unstructured, target Target, scope Scope, expected map[string]map[string]string, existing map[string]bool) gcAction {
+	if !ownedBy(&s, target) {
+		return keep
+	}
+	sourceNs := s.GetNamespace()
+	if target.HubNamespace != "" {
+		sourceNs = s.GetLabels()[SourceNamespaceLabel]
+	}
+	if !scope.covers(sourceNs) {
+		return unscanned
+	}
+
+	uid := s.GetLabels()[WorkloadUIDLabel]
+	if uid == "" {
+		// Written before the labels existed: fall back to the owner reference
+		owner := metav1.GetControllerOf(&s)
+		if owner == nil {
+			return keep
+		}
+		uid = string(owner.UID)
+	}
+
+	names, ok := expected[uid]
+	if !ok {
+		return orphan // Workload deleted
+	}
+	container := s.GetLabels()[ContainerLabel]
+	if container == "" {
+		container, _, _ = unstructured.NestedString(s.Object, "spec", "containerName")
+	}
+	name, ok := names[container]
+	if !ok {
+		return orphan // Container removed or renamed
+	}
+	if s.GetName() == name {
+		return keep
+	}
+	// Old positional name: replace it once the new one has been written
+	if existing[s.GetNamespace()+"/"+name] {
+		return migrate
+	}
+	return keep
+}
+
+// ownedBy reports whether KRS wrote s for target's cluster: it has the cluster's label (none outside
+// multi-cluster mode) and fields managed by FieldManager, or by a legacy manager before the migration
+func ownedBy(s *unstructured.Unstructured, target Target) bool {
+	if s.GetLabels()[ClusterLabel] != target.Cluster {
+		return false
+	}
+	for _, f := range s.GetManagedFields() {
+		if f.Manager == FieldManager || legacyFieldManagers.Has(f.Manager) {
+			return true
+		}
+	}
+	return false
+}
+
+// collect deletes (delete, migrate) or marks one suggestion with message. Returns false if there was nothing to do.
+func collect(ctx context.Context, client dynamic.Interface, target Target, s unstructured.Unstructured, action, message string) (bool, error) {
+	ns, name := s.GetNamespace(), s.GetName()
+	forgetApplied(target.Cluster + "/" + ns + "/" + name)
+
+	if action != config.GCMark {
+		// The UID precondition avoids deleting a suggestion recreated since it was listed
+		uid := s.GetUID()
+		err := client.Resource(suggestionGVR).Namespace(ns).Delete(ctx, name, metav1.DeleteOptions{
+			Preconditions: &metav1.Preconditions{UID: &uid},
+		})
+		if apierrors.IsNotFound(err) || apierrors.IsConflict(err) {
+			return false, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("failed to delete suggestion %s/%s: %v", ns, name, err)
+		}
+		metrics.OrphanedSuggestions.WithLabelValues(target.Cluster, action).Inc()
+		return true, nil
+	}
+
+	// Mark: flag it as stale once, keep the data
+	status := statusFrom(&s)
+	if c := meta.FindStatusCondition(status.Conditions, ConditionStale); c != nil && c.Reason == ReasonOrphaned && c.Message == message {
+		return false, nil
+	}
+	setStaleConditions(&status, status.ObservedGeneration, ReasonOrphaned, message)
+	if err := applyStatus(ctx, client, ns, name, status); err != nil {
+		return false, fmt.Errorf("failed to mark orphaned suggestion %s/%s: %v", ns, name, err)
+	}
+	metrics.OrphanedSuggestions.WithLabelValues(target.Cluster, "mark").Inc()
+	return true, nil
+}
+
+// listSuggestions pages through the suggestions in namespace ("" for all namespaces)
+func listSuggestions(ctx context.Context, client dynamic.Interface, namespace, selector string) ([]unstructured.Unstructured, error) {
+	var items []unstructured.Unstructured
+	continueToken := ""
+	for {
+		list, err := client.Resource(suggestionGVR).Namespace(namespace).List(ctx, metav1.ListOptions{
+			LabelSelector: selector,
+			Limit:         100,
+			Continue:      continueToken,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list suggestions: %v", err)
+		}
+		items = append(items, list.Items...)
+
+		continueToken = list.GetContinue()
+		if continueToken == "" {
+			return items, nil
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package reporter
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// gcSuggestion returns a suggestion in namespace ns with the given labels, managed by manager
+func gcSuggestion(ns, name, manager string, labels map[string]string) unstructured.Unstructured {
+	var s unstructured.Unstructured
+	s.SetNamespace(ns)
+	s.SetName(name)
+	s.SetLabels(labels)
+	if manager != "" {
+		s.SetManagedFields([]metav1.ManagedFieldsEntry{{Manager: manager, Operation: metav1.ManagedFieldsOperationApply}})
+	}
+	return s
+}
+
+func TestClassify(t *testing.T) {
+	hub := Target{Cluster: "east", HubNamespace: "krs"}
+	expected := map[string]map[string]string{
+		"uid-api": {"api": "api-deploy-api-1234", "sidecar": "api-deploy-sidecar-5678"},
+	}
+	existing := map[string]bool{"shop/api-deploy-api-1234": true}
+	labels := func(uid, container string) map[string]string {
+		return map[string]string{WorkloadUIDLabel: uid, ContainerLabel: container}
+	}
+	withOwner := func(s unstructured.Unstructured, uid string) unstructured.Unstructured {
+		controller := true
+		s.SetOwnerReferences([]metav1.OwnerReference{{Kind: "Deployment", Name: "api", UID: types.UID(uid), Controller: &controller}})
+		return s
+	}
+
+	tests := []struct {
+		name       string
+		suggestion unstructured.Unstructured
+		target     Target // Single cluster if zero
+		scope      Scope
+		want       gcAction
+	}{
+		{
+			name:       "current name is kept",
+			suggestion: gcSuggestion("shop", "api-deploy-api-1234", FieldManager, labels("uid-api", "api")),
+			want:       keep,
+		},
+		{
+			name:       "deleted workload is an orphan",
+			suggestion: gcSuggestion("shop", "gone-deploy-api-9999", FieldManager, labels("uid-gone", "api")),
+			want:       orphan,
+		},
+		{
+			name:       "removed container is an orphan",
+			suggestion: gcSuggestion("shop", "api-deploy-worker-0000", FieldManager, labels("uid-api", "worker")),
+			want:       orphan,
+		},
+		{
+			name:       "old name is migrated once the new one exists",
+			suggestion: gcSuggestion("shop", "api", FieldManager, labels("uid-api", "api")),
+			want:       migrate,
+		},
+		{
+			name:       "old name is kept until the new one exists",
+			suggestion: gcSuggestion("shop", "api-sts-1", FieldManager, labels("uid-api", "sidecar")),
+			want:       keep,
+		},
+		{
+			name:       "legacy suggestion falls back to the owner reference",
+			suggestion: withOwner(gcSuggestion("shop", "gone", "controller", map[string]string{ContainerLabel: "api"}), "uid-gone"),
+			want:       orphan,
+		},
+		{
+			name:       "suggestion without workload is kept",
+			suggestion: gcSuggestion("shop", "manual", FieldManager, nil),
+			want:       keep,
+		},
+		{
+			name:       "namespace no longer watched is only unscanned",
+			suggestion: gcSuggestion("legacy", "gone-deploy-api-9999", FieldManager, labels("uid-gone", "api")),
+			scope:      Scope{WatchNamespaces: []string{"shop"}},
+			want:       unscanned,
+		},
+		{
+			name:       "ignored namespace is only unscanned",
+			suggestion: gcSuggestion("kube-system", "dns-deploy-dns-9999", FieldManager, labels("uid-dns", "dns")),
+			scope:      Scope{IgnoredNamespaces: []string{"kube-system"}},
+			want:       unscanned,
+		},
+		{
+			name:       "foreign field manager is kept",
+			suggestion: gcSuggestion("shop", "gone-deploy-api-9999", "other-controller", labels("uid-gone", "api")),
+			want:       keep,
+		},
+		{
+			name:       "other cluster is kept",
+			suggestion: gcSuggestion("shop", "gone-deploy-api-9999", FieldManager, map[string]string{ClusterLabel: "west", WorkloadUIDLabel: "uid-gone"}),
+			want:       keep,
+		},
+		{
+			name: "hub suggestion is scoped by its source namespace",
+			suggestion: gcSuggestion("krs", "east-legacy-gone-deploy-api-9999", FieldManager,
+				map[string]string{ClusterLabel: "east", SourceNamespaceLabel: "legacy", WorkloadUIDLabel: "uid-gone"}),
+			target: hub,
+			scope:  Scope{WatchNamespaces: []string{"shop"}},
+			want:   unscanned,
+		},
+		{
+			name: "hub suggestion of a deleted workload is an orphan",
+			suggestion: gcSuggestion("krs", "east-shop-gone-deploy-api-9999", FieldManager,
+				map[string]string{ClusterLabel: "east", SourceNamespaceLabel: "shop", WorkloadUIDLabel: "uid-gone", ContainerLabel: "api"}),
+			target: hub,
+			want:   orphan,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classify(tt.suggestion, tt.target, tt.scope, expected, existing); got != tt.want {
+				t.Errorf("classify() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package reporter
+
+import (
+	"github.com/joe-l-mathew/kube-resource-suggest/pkg/config"
+	"github.com/joe-l-mathew/kube-resource-suggest/pkg/engine"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// HistoryEntry is one recommendation in a suggestion's history
+type HistoryEntry struct {
+	Time          metav1.Time `json:"time"`
+	Source        string      `json:"source"`
+	Status        string      `json:"status"`
+	CpuRequest    string      `json:"cpuRequest"`
+	CpuLimit      string      `json:"cpuLimit"`
+	MemoryRequest string      `json:"memoryRequest"`
+	MemoryLimit   string      `json:"memoryLimit"`
+}
+
+// sameRecommendation reports whether two entries recommend the same thing
+func (e HistoryEntry) sameRecommendation(o HistoryEntry) bool {
+	e.Time, o.Time = metav1.Time{}, metav1.Time{}
+	return e == o
+}
+
+// historyEntry returns the recommended values of s as a history entry
+func historyEntry(s *engine.SuggestionResult, now metav1.Time) HistoryEntry {
+	return HistoryEntry{
+		Time:          now,
+		Source:        s.Source,
+		Status:        s.Status,
+		CpuRequest:    resource.NewScaledQuantity(s.TargetCpuRequestNano, resource.Nano).String(),
+		CpuLimit:      resource.NewScaledQuantity(s.TargetCpuLimitNano, resource.Nano).String(),
+		MemoryRequest: resource.NewQuantity(s.TargetMemoryRequestBytes, resource.BinarySI).String(),
+		MemoryLimit:   resource.NewQuantity(s.TargetMemoryLimitBytes, resource.BinarySI).String(),
+	}
+}
+
+// appendHistory adds entry if the recommendation changed, then drops entries beyond cfg's bounds.
+// Only changes are recorded, so a steady recommendation keeps a single entry.
+func appendHistory(history []HistoryEntry, entry HistoryEntry, cfg config.HistoryConfig) []HistoryEntry {
+	if cfg.MaxEntries == 0 {
+		return nil
+	}
+	if n := len(history); n == 0 || !history[n-1].sameRecommendation(entry) {
+		history = append(history, entry)
+	}
+
+	if cfg.MaxAge.Duration > 0 {
+		cutoff := entry.Time.Add(-cfg.MaxAge.Duration)
+		// Keep the newest entry even if old: it is still the current recommendation
+		for len(history) > 1 && history[0].Time.Time.Before(cutoff) {
+			history = history[1:]
+		}
+	}
+	if len(history) > cfg.MaxEntries {
+		history = history[len(history)-cfg.MaxEntries:]
+	}
+	return history
+}
@@ -0,0 +1,75 @@
+package reporter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// hashLength is the number of hex characters of the name/label hash
+const hashLength = 8
+
+// suggestionName returns the name and namespace of the ResourceSuggestion for one container of a workload.
+// Names read <workload>-<kind>-<container>-<hash>; the hash covers the full identity (cluster, namespace,
+// kind, workload, container), so names never collide even when the readable part is ambiguous or truncated.
+func suggestionName(target Target, namespace, workloadName, kind, container string) (string, string) {
+	readable := []string{workloadName, kindShort(kind), container}
+	identity := []string{target.Cluster, namespace, kind, workloadName, container}
+
+	if target.HubNamespace != "" {
+		// Hub: one namespace for all clusters, so lead with where the workload lives
+		readable = append([]string{target.Cluster, namespace}, readable...)
+		namespace = target.HubNamespace
+	}
+	return withHash(strings.Join(readable, "-"), strings.Join(identity, "/"), validation.DNS1123SubdomainMaxLength), namespace
+}
+
+// kindShort abbreviates a workload kind for names
+func kindShort(kind string) string {
+	switch kind {
+	case "Deployment":
+		return "deploy"
+	case "StatefulSet":
+		return "sts"
+	case "DaemonSet":
+		return "ds"
+	}
+	return strings.ToLower(kind)
+}
+
+// labelValue returns v if it is a valid label value, otherwise a truncated form with a hash
+func labelValue(v string) string {
+	if len(v) <= validation.LabelValueMaxLength {
+		return v
+	}
+	return withHash(v, v, validation.LabelValueMaxLength)
+}
+
+// withHash appends a short hash of identity to readable, truncating readable to fit maxLength
+func withHash(readable, identity string, maxLength int) string {
+	sum := sha256.Sum256([]byte(identity))
+	hash := hex.EncodeToString(sum[:])[:hashLength]
+	if limit := maxLength - hashLength - 1; len(readable) > limit {
+		readable = strings.TrimRight(readable[:limit], "-.")
+	}
+	return readable + "-" + hash
+}
+
+// containerNames returns the names of a workload's containers, in spec order
+func containerNames(workload unstructured.Unstructured) []string {
+	containers, _, _ := unstructured.NestedSlice(workload.Object, "spec", "template", "spec", "containers")
+	names := make([]string, 0, len(containers))
+	for _, cInt := range containers {
+		cMap, ok := cInt.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if name, ok := cMap["name"].(string); ok {
+			names = append(names, name)
+		}
+	}
+	return names
+}
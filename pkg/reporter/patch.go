@@ -0,0 +1,113 @@
+package reporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/joe-l-mathew/kube-resource-suggest/pkg/engine"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// buildPatch returns the spec.patch of a workload's suggestions: patches setting the requests
+// of every suggested container to the recommended values, and a kubectl command applying them.
+// Limits are only set where the container already has one, so no limit is introduced.
+// Other resources (e.g. ephemeral-storage) are left alone. Returns nil if no suggested
+// container is in the workload's pod template.
+func buildPatch(workload unstructured.Unstructured, suggestions []*engine.SuggestionResult) map[string]interface{} {
+	containers, _, _ := unstructured.NestedSlice(workload.Object, "spec", "template", "spec", "containers")
+
+	var smpContainers []interface{}
+	var ops []map[string]interface{}
+	for _, s := range suggestions {
+		index := -1
+		var resources map[string]interface{}
+		for i, cInt := range containers {
+			cMap, ok := cInt.(map[string]interface{})
+			if !ok || cMap["name"] != s.ContainerName {
+				continue
+			}
+			index = i
+			resources, _ = cMap["resources"].(map[string]interface{})
+			break
+		}
+		if index < 0 {
+			continue
+		}
+
+		entry := historyEntry(s, metav1.Time{})
+		currentLimits, _ := resources["limits"].(map[string]interface{})
+		limits := quantities(entry.CpuLimit, entry.MemoryLimit)
+		for name := range limits {
+			if _, ok := currentLimits[name]; !ok {
+				delete(limits, name)
+			}
+		}
+		desired := map[string]map[string]string{"requests": quantities(entry.CpuRequest, entry.MemoryRequest)}
+		if len(limits) > 0 {
+			desired["limits"] = limits
+		}
+
+		// 1. Strategic merge: containers are merged by name
+		smpContainers = append(smpContainers, map[string]interface{}{"name": s.ContainerName, "resources": desired})
+
+		// 2. JSON patch, addressing the container by index guarded by a test of its name.
+		// "add" fails on a missing parent, so create whatever is missing
+		base := fmt.Sprintf("/spec/template/spec/containers/%d", index)
+		ops = append(ops, map[string]interface{}{"op": "test", "path": base + "/name", "value": s.ContainerName})
+		if resources == nil {
+			ops = append(ops, map[string]interface{}{"op": "add", "path": base + "/resources", "value": desired})
+			continue
+		}
+		for _, kind := range []string{"requests", "limits"} {
+			values, ok := desired[kind]
+			if !ok {
+				continue
+			}
+			if _, ok := resources[kind].(map[string]interface{}); !ok {
+				ops = append(ops, map[string]interface{}{"op": "add", "path": base + "/resources/" + kind, "value": values})
+				continue
+			}
+			for _, name := range []string{"cpu", "memory"} {
+				if value, ok := values[name]; ok {
+					ops = append(ops, map[string]interface{}{"op": "add", "path": base + "/resources/" + kind + "/" + name, "value": value})
+				}
+			}
+		}
+	}
+	if len(smpContainers) == 0 {
+		return nil
+	}
+
+	smp, _ := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{"containers": smpContainers},
+			},
+		},
+	})
+	jsonPatch, _ := json.Marshal(ops)
+
+	// 3. kubectl command for the strategic merge patch
+	kubectl := fmt.Sprintf("kubectl patch %s %s -n %s --type strategic -p '%s'",
+		strings.ToLower(workload.GetKind()), workload.GetName(), workload.GetNamespace(), smp)
+
+	return map[string]interface{}{
+		"strategicMerge": string(smp),
+		"json":           string(jsonPatch),
+		"kubectl":        kubectl,
+	}
+}
+
+// quantities maps cpu and memory to the values that are set
+func quantities(cpu, memory string) map[string]string {
+	q := make(map[string]string, 2)
+	if cpu != "0" {
+		q["cpu"] = cpu
+	}
+	if memory != "0" {
+		q["memory"] = memory
+	}
+	return q
+}
@@ -0,0 +1,174 @@
+package reporter
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/joe-l-mathew/kube-resource-suggest/pkg/engine"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestBuildPatch(t *testing.T) {
+	const mi = 1024 * 1024
+	workload := func(containers ...interface{}) unstructured.Unstructured {
+		w := unstructured.Unstructured{Object: map[string]interface{}{
+			"spec": map[string]interface{}{
+				"template": map[string]interface{}{
+					"spec": map[string]interface{}{"containers": containers},
+				},
+			},
+		}}
+		w.SetKind("Deployment")
+		w.SetNamespace("shop")
+		w.SetName("api")
+		return w
+	}
+	container := func(name string, resources map[string]interface{}) interface{} {
+		c := map[string]interface{}{"name": name}
+		if resources != nil {
+			c["resources"] = resources
+		}
+		return c
+	}
+	// suggestion recommends 250m/256Mi, limited to 500m/512Mi
+	suggestion := func(container string) *engine.SuggestionResult {
+		return &engine.SuggestionResult{
+			ContainerName:            container,
+			TargetCpuRequestNano:     250e6,
+			TargetCpuLimitNano:       500e6,
+			TargetMemoryRequestBytes: 256 * mi,
+			TargetMemoryLimitBytes:   512 * mi,
+		}
+	}
+	requests := map[string]interface{}{"cpu": "250m", "memory": "256Mi"}
+
+	tests := []struct {
+		name        string
+		workload    unstructured.Unstructured
+		suggestions []*engine.SuggestionResult
+		wantSMP     []interface{} // Containers of the strategic merge patch
+		wantJSON    []interface{}
+	}{
+		{
+			name:        "missing resources are added without limits",
+			workload:    workload(container("api", nil)),
+			suggestions: []*engine.SuggestionResult{suggestion("api")},
+			wantSMP:     []interface{}{map[string]interface{}{"name": "api", "resources": map[string]interface{}{"requests": requests}}},
+			wantJSON: []interface{}{
+				map[string]interface{}{"op": "test", "path": "/spec/template/spec/containers/0/name", "value": "api"},
+				map[string]interface{}{"op": "add", "path": "/spec/template/spec/containers/0/resources", "value": map[string]interface{}{"requests": requests}},
+			},
+		},
+		{
+			name: "missing requests are added, only existing limits change",
+			workload: workload(container("api", map[string]interface{}{
+				"limits": map[string]interface{}{"memory": "1Gi"},
+			})),
+			suggestions: []*engine.SuggestionResult{suggestion("api")},
+			wantSMP: []interface{}{map[string]interface{}{"name": "api", "resources": map[string]interface{}{
+				"requests": requests,
+				"limits":   map[string]interface{}{"memory": "512Mi"},
+			}}},
+			wantJSON: []interface{}{
+				map[string]interface{}{"op": "test", "path": "/spec/template/spec/containers/0/name", "value": "api"},
+				map[string]interface{}{"op": "add", "path": "/spec/template/spec/containers/0/resources/requests", "value": requests},
+				map[string]interface{}{"op": "add", "path": "/spec/template/spec/containers/0/resources/limits/memory", "value": "512Mi"},
+			},
+		},
+		{
+			name: "missing limits are left unset",
+			workload: workload(container("api", map[string]interface{}{
+				"requests": map[string]interface{}{"cpu": "1", "ephemeral-storage": "1Gi"},
+			})),
+			suggestions: []*engine.SuggestionResult{suggestion("api")},
+			wantSMP:     []interface{}{map[string]interface{}{"name": "api", "resources": map[string]interface{}{"requests": requests}}},
+			wantJSON: []interface{}{
+				map[string]interface{}{"op": "test", "path": "/spec/template/spec/containers/0/name", "value": "api"},
+				map[string]interface{}{"op": "add", "path": "/spec/template/spec/containers/0/resources/requests/cpu", "value": "250m"},
+				map[string]interface{}{"op": "add", "path": "/spec/template/spec/containers/0/resources/requests/memory", "value": "256Mi"},
+			},
+		},
+		{
+			name: "multiple containers are addressed by index",
+			workload: workload(
+				container("init-like", nil),
+				container("api", map[string]interface{}{"requests": map[string]interface{}{"cpu": "1"}}),
+				container("sidecar", map[string]interface{}{"limits": map[string]interface{}{"cpu": "1"}}),
+			),
+			suggestions: []*engine.SuggestionResult{suggestion("api"), suggestion("sidecar"), suggestion("removed")},
+			wantSMP: []interface{}{
+				map[string]interface{}{"name": "api", "resources": map[string]interface{}{"requests": requests}},
+				map[string]interface{}{"name": "sidecar", "resources": map[string]interface{}{
+					"requests": requests,
+					"limits":   map[string]interface{}{"cpu": "500m"},
+				}},
+			},
+			wantJSON: []interface{}{
+				map[string]interface{}{"op": "test", "path": "/spec/template/spec/containers/1/name", "value": "api"},
+				map[string]interface{}{"op": "add", "path": "/spec/template/spec/containers/1/resources/requests/cpu", "value": "250m"},
+				map[string]interface{}{"op": "add", "path": "/spec/template/spec/containers/1/resources/requests/memory", "value": "256Mi"},
+				map[string]interface{}{"op": "test", "path": "/spec/template/spec/containers/2/name", "value": "sidecar"},
+				map[string]interface{}{"op": "add", "path": "/spec/template/spec/containers/2/resources/requests", "value": requests},
+				map[string]interface{}{"op": "add", "path": "/spec/template/spec/containers/2/resources/limits/cpu", "value": "500m"},
+			},
+		},
+		{
+			name:        "no suggested container in the template",
+			workload:    workload(container("api", nil)),
+			suggestions: []*engine.SuggestionResult{suggestion("removed")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patch := buildPatch(tt.workload, tt.suggestions)
+			if tt.wantSMP == nil {
+				if patch != nil {
+					t.Fatalf("buildPatch() = %v, want nil", patch)
+				}
+				return
+			}
+
+			var smp map[string]interface{}
+			if err := json.Unmarshal([]byte(patch["strategicMerge"].(string)), &smp); err != nil {
+				t.Fatalf("invalid strategic merge patch: %v", err)
+			}
+			containers, _, _ := unstructured.NestedSlice(smp, "spec", "template", "spec", "containers")
+			if !reflect.DeepEqual(containers, tt.wantSMP) {
+				t.Errorf("strategic merge containers = %v, want %v", containers, tt.wantSMP)
+			}
+
+			var ops []interface{}
+			if err := json.Unmarshal([]byte(patch["json"].(string)), &ops); err != nil {
+				t.Fatalf("invalid JSON patch: %v", err)
+			}
+			if !reflect.DeepEqual(ops, tt.wantJSON) {
+				t.Errorf("JSON patch = %v, want %v", ops, tt.wantJSON)
+			}
+
+			wantKubectl := "kubectl patch deployment api -n shop --type strategic -p '" + patch["strategicMerge"].(string) + "'"
+			if patch["kubectl"] != wantKubectl {
+				t.Errorf("kubectl = %q, want %q", patch["kubectl"], wantKubectl)
+			}
+		})
+	}
+}
+
+func TestBuildPatchKubectl(t *testing.T) {
+	w := unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{"containers": []interface{}{map[string]interface{}{"name": "db"}}},
+			},
+		},
+	}}
+	w.SetKind("StatefulSet")
+	w.SetNamespace("data")
+	w.SetName("postgres")
+	s := &engine.SuggestionResult{ContainerName: "db", TargetCpuRequestNano: 1e9, TargetMemoryRequestBytes: 2 << 30}
+
+	want := `kubectl patch statefulset postgres -n data --type strategic -p '{"spec":{"template":{"spec":{"containers":[{"name":"db","resources":{"requests":{"cpu":"1","memory":"2Gi"}}}]}}}}'`
+	if got := buildPatch(w, []*engine.SuggestionResult{s})["kubectl"]; got != want {
+		t.Errorf("kubectl = %s, want %s", got, want)
+	}
+}
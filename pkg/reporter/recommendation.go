@@ -0,0 +1,66 @@
+package reporter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Recommendations returns the recommended requests and limits of each container of a workload,
+// keyed by container name. Containers that are Optimal or whose suggestion is Stale are left out.
+func Recommendations(ctx context.Context, src TrendSource, namespace, workload, kind string) (map[string]corev1.ResourceRequirements, error) {
+	suggestions, err := workloadSuggestions(ctx, src, namespace, workload, kind)
+	if err != nil {
+		return nil, err
+	}
+
+	recommended := make(map[string]corev1.ResourceRequirements, len(suggestions))
+	for _, s := range suggestions {
+		if status, _, _ := unstructured.NestedString(s.Object, "spec", "status"); status == "Optimal" {
+			continue
+		}
+		if meta.IsStatusConditionTrue(statusFrom(&s).Conditions, ConditionStale) {
+			continue
+		}
+		container := s.GetLabels()[ContainerLabel]
+		resources, err := patchResources(&s, container)
+		if err != nil {
+			return nil, fmt.Errorf("suggestion %s: %v", s.GetName(), err)
+		}
+		if resources != nil {
+			recommended[container] = *resources
+		}
+	}
+	return recommended, nil
+}
+
+// patchResources reads the recommended resources of container from a suggestion's strategic merge patch,
+// which covers every suggested container of the workload. Returns nil if the patch does not include it.
+func patchResources(s *unstructured.Unstructured, container string) (*corev1.ResourceRequirements, error) {
+	smp, _, _ := unstructured.NestedString(s.Object, "spec", "patch", "strategicMerge")
+	if smp == "" {
+		return nil, nil
+	}
+	var patch struct {
+		Spec struct {
+			Template struct {
+				Spec struct {
+					Containers []corev1.Container `json:"containers"`
+				} `json:"spec"`
+			} `json:"template"`
+		} `json:"spec"`
+	}
+	if err := json.Unmarshal([]byte(smp), &patch); err != nil {
+		return nil, fmt.Errorf("invalid spec.patch.strategicMerge: %v", err)
+	}
+	for _, c := range patch.Spec.Template.Spec.Containers {
+		if c.Name == container {
+			return &c.Resources, nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,342 @@
+package reporter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/joe-l-mathew/kube-resource-suggest/pkg/engine"
+	"github.com/joe-l-mathew/kube-resource-suggest/pkg/metrics"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/dynamic"
+)
+
+var (
+	reportGVR = schema.GroupVersionResource{
+		Group:    "suggester.krs.io",
+		Version:  "v1alpha1",
+		Resource: "resourcesuggestionreports",
+	}
+	clusterReportGVR = schema.GroupVersionResource{
+		Group:    "suggester.krs.io",
+		Version:  "v1alpha1",
+		Resource: "clusterresourcesuggestionreports",
+	}
+)
+
+// ReportName names the report of a namespace, and the cluster report in single-cluster mode.
+// In multi-cluster mode the cluster report is named after the cluster.
+const ReportName = "summary"
+
+// Rollup collects the suggestions of one scan of a cluster for its reports. Safe for concurrent use.
+type Rollup struct {
+	mu        sync.Mutex
+	workloads []workloadTotals
+}
+
+// workloadTotals sums the suggestions of one workload
+type workloadTotals struct {
+	namespace, name, kind string
+	containers            int
+	counts                statusCounts
+	current, recommended  requests
+	// waste sums, per container, the requests above the recommendation
+	waste requests
+}
+
+type requests struct {
+	cpuNano, memoryBytes int64
+}
+
+func (r *requests) add(o requests) {
+	r.cpuNano += o.cpuNano
+	r.memoryBytes += o.memoryBytes
+}
+
+// NewRollup returns an empty Rollup
+func NewRollup() *Rollup {
+	return &Rollup{}
+}
+
+// Add records a scanned workload and its suggestions; none means there was no usage data
+func (r *Rollup) Add(workload unstructured.Unstructured, suggestions []*engine.SuggestionResult) {
+	w := workloadTotals{namespace: workload.GetNamespace(), name: workload.GetName(), kind: workload.GetKind()}
+	for _, s := range suggestions {
+		w.containers++
+		w.counts.add(s.Status)
+		current := requests{s.CurrentCpuRequestNano, s.CurrentMemoryRequestBytes}
+		recommended := requests{s.TargetCpuRequestNano, s.TargetMemoryRequestBytes}
+		w.current.add(current)
+		w.recommended.add(recommended)
+		w.waste.add(requests{max(current.cpuNano-recommended.cpuNano, 0), max(current.memoryBytes-recommended.memoryBytes, 0)})
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.workloads = append(r.workloads, w)
+}
+
+// reportStatus is the content of a ResourceSuggestionReport or ClusterResourceSuggestionReport
+type reportStatus struct {
+	LastUpdated metav1.Time `json:"lastUpdated"`
+	// Workloads scanned, and how many of them had usage data (coverage)
+	Workloads         int    `json:"workloads"`
+	WorkloadsWithData int    `json:"workloadsWithData"`
+	Coverage          string `json:"coverage"`
+	Containers        int    `json:"containers"`
+	// Counts are containers by suggestion status
+	Counts      statusCounts     `json:"counts"`
+	Current     reportResources  `json:"current"`
+	Recommended reportResources  `json:"recommended"`
+	Savings     reportResources  `json:"savings"`
+	TopWasteful []wastefulReport `json:"topWasteful,omitempty"`
+}
+
+type statusCounts struct {
+	Optimal          int `json:"optimal"`
+	Overprovisioned  int `json:"overprovisioned"`
+	Underprovisioned int `json:"underprovisioned"`
+}
+
+func (c *statusCounts) add(status string) {
+	switch status {
+	case "Optimal":
+		c.Optimal++
+	case "Overprovisioned":
+		c.Overprovisioned++
+	case "Underprovisioned":
+		c.Underprovisioned++
+	}
+}
+
+// reportResources are summed requests
+type reportResources struct {
+	CpuRequest    string `json:"cpuRequest"`
+	MemoryRequest string `json:"memoryRequest"`
+}
+
+// wastefulReport is a workload whose requests exceed the recommendation the most
+type wastefulReport struct {
+	// Namespace is set in the cluster report only
+	Namespace            string `json:"namespace,omitempty"`
+	Name                 string `json:"name"`
+	Kind                 string `json:"kind"`
+	CpuRequestSavings    string `json:"cpuRequestSavings"`
+	MemoryRequestSavings string `json:"memoryRequestSavings"`
+}
+
+// WriteReports writes a ResourceSuggestionReport per namespace in rollup, and deletes those of
+// namespaces without workloads now. In cluster-wide mode (no namespaces) it also writes the
+// ClusterResourceSuggestionReport. Call it after a complete scan only, or totals are too low.
+func WriteReports(ctx context.Context, client dynamic.Interface, target Target, rollup *Rollup, namespaces []string, topN int) error {
+	rollup.mu.Lock()
+	workloads := slices.Clone(rollup.workloads)
+	rollup.mu.Unlock()
+
+	byNamespace := make(map[string][]workloadTotals)
+	for _, w := range workloads {
+		byNamespace[w.namespace] = append(byNamespace[w.namespace], w)
+	}
+	now := metav1.Now()
+
+	// 1. Namespace reports
+	var errs []error
+	written := make(map[string]bool, len(byNamespace))
+	for _, ns := range slices.Sorted(maps.Keys(byNamespace)) {
+		name, reportNs := reportName(target, ns)
+		written[reportNs+"/"+name] = true
+		reportLabels := map[string]interface{}{SourceNamespaceLabel: ns}
+		if target.Cluster != "" {
+			reportLabels[ClusterLabel] = target.Cluster
+		}
+		status := summarize(byNamespace[ns], topN, false, now)
+		if err := applyReport(ctx, client.Resource(reportGVR).Namespace(reportNs), "ResourceSuggestionReport", name, reportNs, reportLabels, status); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	// 2. Cluster report
+	if len(namespaces) == 0 {
+		name := ReportName
+		reportLabels := map[string]interface{}{}
+		if target.Cluster != "" {
+			name = target.Cluster
+			reportLabels[ClusterLabel] = target.Cluster
+		}
+		status := summarize(workloads, topN, true, now)
+		if err := applyReport(ctx, client.Resource(clusterReportGVR), "ClusterResourceSuggestionReport", name, "", reportLabels, status); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	// 3. Reports of namespaces that are now empty or ignored
+	if err := deleteStaleReports(ctx, client, target, namespaces, written); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// reportName returns the name and namespace of the report for namespace
+func reportName(target Target, namespace string) (string, string) {
+	if target.HubNamespace == "" {
+		return ReportName, namespace
+	}
+	// Hub: one namespace for all clusters
+	readable := strings.Join([]string{target.Cluster, namespace}, "-")
+	return withHash(readable, target.Cluster+"/"+namespace, validation.DNS1123SubdomainMaxLength), target.HubNamespace
+}
+
+// summarize totals workloads. The top wasteful workloads are ranked by their share of the
+// CPU plus their share of the memory requested above the recommendation.
+func summarize(workloads []workloadTotals, topN int, withNamespace bool, now metav1.Time) reportStatus {
+	status := reportStatus{LastUpdated: now, Workloads: len(workloads)}
+	var current, recommended, waste requests
+	for _, w := range workloads {
+		if w.containers > 0 {
+			status.WorkloadsWithData++
+		}
+		status.Containers += w.containers
+		status.Counts.Optimal += w.counts.Optimal
+		status.Counts.Overprovisioned += w.counts.Overprovisioned
+		status.Counts.Underprovisioned += w.counts.Underprovisioned
+		current.add(w.current)
+		recommended.add(w.recommended)
+		waste.add(w.waste)
+	}
+	if status.Workloads > 0 {
+		status.Coverage = fmt.Sprintf("%d%%", status.WorkloadsWithData*100/status.Workloads)
+	}
+	status.Current = reportResourcesOf(current)
+	status.Recommended = reportResourcesOf(recommended)
+	status.Savings = reportResourcesOf(requests{current.cpuNano - recommended.cpuNano, current.memoryBytes - recommended.memoryBytes})
+
+	share := func(w workloadTotals) float64 {
+		var s float64
+		if waste.cpuNano > 0 {
+			s += float64(w.waste.cpuNano) / float64(waste.cpuNano)
+		}
+		if waste.memoryBytes > 0 {
+			s += float64(w.waste.memoryBytes) / float64(waste.memoryBytes)
+		}
+		return s
+	}
+	ranked := slices.DeleteFunc(slices.Clone(workloads), func(w workloadTotals) bool { return share(w) == 0 })
+	slices.SortStableFunc(ranked, func(a, b workloadTotals) int {
+		if d := share(b) - share(a); d != 0 {
+			if d > 0 {
+				return 1
+			}
+			return -1
+		}
+		return strings.Compare(a.namespace+"/"+a.name, b.namespace+"/"+b.name)
+	})
+	for _, w := range ranked[:min(topN, len(ranked))] {
+		entry := wastefulReport{
+			Name:                 w.name,
+			Kind:                 w.kind,
+			CpuRequestSavings:    cpuQuantity(w.waste.cpuNano),
+			MemoryRequestSavings: memoryQuantity(w.waste.memoryBytes),
+		}
+		if withNamespace {
+			entry.Namespace = w.namespace
+		}
+		status.TopWasteful = append(status.TopWasteful, entry)
+	}
+	return status
+}
+
+func reportResourcesOf(r requests) reportResources {
+	return reportResources{CpuRequest: cpuQuantity(r.cpuNano), MemoryRequest: memoryQuantity(r.memoryBytes)}
+}
+
+// cpuQuantity formats CPU rounded to millicores
+func cpuQuantity(nano int64) string {
+	return resource.NewMilliQuantity(nano/1000000, resource.DecimalSI).String()
+}
+
+// memoryQuantity formats memory rounded to MiB
+func memoryQuantity(bytes int64) string {
+	const mi = 1024 * 1024
+	return resource.NewQuantity(bytes/mi*mi, resource.BinarySI).String()
+}
+
+// applyReport writes a report with server-side apply
+func applyReport(ctx context.Context, client dynamic.ResourceInterface, kind, name, ns string, reportLabels map[string]interface{}, status reportStatus) error {
+	data, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	metadata := map[string]interface{}{
+		"name":   name,
+		"labels": reportLabels,
+	}
+	if ns != "" {
+		metadata["namespace"] = ns
+	}
+	obj := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "suggester.krs.io/v1alpha1",
+			"kind":       kind,
+			"metadata":   metadata,
+			"status":     raw,
+		},
+	}
+
+	_, err = client.Apply(ctx, name, obj, metav1.ApplyOptions{FieldManager: FieldManager, Force: true})
+	if err != nil {
+		return fmt.Errorf("failed to apply %s %s: %v", kind, name, err)
+	}
+	metrics.SuggestionWrites.WithLabelValues("report").Inc()
+	return nil
+}
+
+// deleteStaleReports deletes the namespace reports of this cluster that were not just written
+func deleteStaleReports(ctx context.Context, client dynamic.Interface, target Target, namespaces []string, written map[string]bool) error {
+	selector := labels.NewSelector()
+	hasSource, _ := labels.NewRequirement(SourceNamespaceLabel, selection.Exists, nil)
+	selector = selector.Add(*hasSource)
+	if target.Cluster != "" {
+		sameCluster, _ := labels.NewRequirement(ClusterLabel, selection.Equals, []string{target.Cluster})
+		selector = selector.Add(*sameCluster)
+	}
+	if target.HubNamespace != "" {
+		namespaces = []string{target.HubNamespace}
+	} else if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+
+	var errs []error
+	for _, ns := range namespaces {
+		list, err := client.Resource(reportGVR).Namespace(ns).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to list reports: %v", err))
+			continue
+		}
+		for _, r := range list.Items {
+			if written[r.GetNamespace()+"/"+r.GetName()] {
+				continue
+			}
+			err := client.Resource(reportGVR).Namespace(r.GetNamespace()).Delete(ctx, r.GetName(), metav1.DeleteOptions{})
+			if err != nil && !apierrors.IsNotFound(err) {
+				errs = append(errs, fmt.Errorf("failed to delete report %s/%s: %v", r.GetNamespace(), r.GetName(), err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -2,13 +2,20 @@ package reporter
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"time"
 
+	"github.com/joe-l-mathew/kube-resource-suggest/pkg/config"
 	"github.com/joe-l-mathew/kube-resource-suggest/pkg/engine"
+	"github.com/joe-l-mathew/kube-resource-suggest/pkg/metrics"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/record"
 )
 
 var suggestionGVR = schema.GroupVersionResource{
@@ -17,35 +24,115 @@ var suggestionGVR = schema.GroupVersionResource{
 	Resource: "resourcesuggestions",
 }
 
-// UpdateOrReport creates or updates a ResourceSuggestion CR. Returns true if a change was made.
-func UpdateOrReport(client dynamic.Interface, workload unstructured.Unstructured, suggestion *engine.SuggestionResult) (bool, error) {
-	ctx := context.TODO()
-	// Custom Naming Logic
-	baseName := suggestion.WorkloadName
+// FieldManager owns the fields KRS sets on a ResourceSuggestion
+const FieldManager = "krs-controller"
 
-	switch suggestion.WorkloadType {
-	case "StatefulSet":
-		baseName += "-sts"
-	case "DaemonSet":
-		baseName += "-ds"
+// ClusterLabel and SourceNamespaceLabel identify where a suggestion's workload lives;
+// the others identify which container it is for and allow lookups by selector
+const (
+	ClusterLabel         = "krs.io/cluster"
+	SourceNamespaceLabel = "krs.io/source-namespace"
+	WorkloadLabel        = "krs.io/workload"
+	KindLabel            = "krs.io/kind"
+	ContainerLabel       = "krs.io/container"
+	WorkloadUIDLabel     = "krs.io/workload-uid"
+)
+
+// Target is where suggestions for one cluster are written
+type Target struct {
+	// Cluster labels suggestions with krs.io/cluster; empty for single-cluster mode
+	Cluster string
+	// HubNamespace, if set, writes into this namespace of a hub cluster instead
+	// of next to the workload. Names are prefixed with cluster and namespace,
+	// and there is no owner reference since the workload lives elsewhere.
+	HubNamespace string
+	// Recorder records Events on workloads (in their own cluster); nil disables them
+	Recorder record.EventRecorder
+}
+
+// UpdateOrReport creates or updates the ResourceSuggestion CR of each of a workload's container suggestions
+// with server-side apply, then writes its status. Hysteresis is applied to the suggestions in place, and
+// each suggestion carries one patch covering all of them.
+// Returns per suggestion whether its spec changed (always true for the first write after a restart) and its error.
+func UpdateOrReport(ctx context.Context, client dynamic.Interface, target Target, workload unstructured.Unstructured, suggestions []*engine.SuggestionResult) ([]bool, []error) {
+	changed := make([]bool, len(suggestions))
+	errs := make([]error, len(suggestions))
+
+	// 1. Hysteresis against the published recommendations (read once after a restart)
+	previous := make([]appliedState, len(suggestions))
+	published := make([]*engine.Published, len(suggestions))
+	var stable []*engine.SuggestionResult
+	for i, s := range suggestions {
+		name, ns := suggestionName(target, workload.GetNamespace(), s.WorkloadName, s.WorkloadType, s.ContainerName)
+		previous[i], _ = lookupApplied(target.Cluster + "/" + ns + "/" + name)
+		if previous[i].spec == nil {
+			if previous[i], errs[i] = loadPrevious(ctx, client, ns, name); errs[i] != nil {
+				errs[i] = fmt.Errorf("failed to get suggestion: %v", errs[i])
+				continue
+			}
+		}
+		published[i] = engine.Stabilize(s, previous[i].published, config.Get().Recommendation.Hysteresis, time.Now())
+		stable = append(stable, s)
 	}
 
-	// Add numeric suffix if multiple containers exist
-	if suggestion.TotalContainers > 1 {
-		baseName += fmt.Sprintf("-%d", suggestion.ContainerIndex+1)
+	// 2. One patch for the workload, from the published values
+	patch := buildPatch(workload, stable)
+
+	// 3. Write each suggestion
+	for i, s := range suggestions {
+		if errs[i] == nil {
+			changed[i], errs[i] = report(ctx, client, target, workload, s, previous[i], published[i], patch)
+		}
 	}
+	return changed, errs
+}
 
-	name := baseName
-	ns := workload.GetNamespace()
+// report writes one container's suggestion and its status
+func report(ctx context.Context, client dynamic.Interface, target Target, workload unstructured.Unstructured, suggestion *engine.SuggestionResult,
+	previous appliedState, published *engine.Published, patch map[string]interface{}) (bool, error) {
+	sourceNs := workload.GetNamespace()
+	name, ns := suggestionName(target, sourceNs, suggestion.WorkloadName, suggestion.WorkloadType, suggestion.ContainerName)
 
-	// 1. Prepare OwnerReference
-	ownerRef := metav1.OwnerReference{
-		APIVersion: workload.GetAPIVersion(),
-		Kind:       workload.GetKind(),
-		Name:       workload.GetName(),
-		UID:        workload.GetUID(),
-		Controller: func() *bool { b := true; return &b }(),
+	metadata := map[string]interface{}{
+		"name":      name,
+		"namespace": ns,
 	}
+	labels := map[string]interface{}{
+		WorkloadLabel:    labelValue(suggestion.WorkloadName),
+		KindLabel:        suggestion.WorkloadType,
+		ContainerLabel:   suggestion.ContainerName,
+		WorkloadUIDLabel: string(workload.GetUID()),
+	}
+	if target.Cluster != "" {
+		labels[ClusterLabel] = target.Cluster
+	}
+
+	if target.HubNamespace != "" {
+		// No owner reference: the workload lives in another cluster
+		labels[SourceNamespaceLabel] = sourceNs
+	} else {
+		// 1. Prepare OwnerReference
+		ownerRef := metav1.OwnerReference{
+			APIVersion: workload.GetAPIVersion(),
+			Kind:       workload.GetKind(),
+			Name:       workload.GetName(),
+			UID:        workload.GetUID(),
+			Controller: func() *bool { b := true; return &b }(),
+		}
+		metadata["ownerReferences"] = []interface{}{
+			map[string]interface{}{
+				"apiVersion": ownerRef.APIVersion,
+				"kind":       ownerRef.Kind,
+				"name":       ownerRef.Name,
+				"uid":        ownerRef.UID,
+				"controller": *ownerRef.Controller,
+			},
+		}
+	}
+	metadata["labels"] = labels
+
+	key := target.Cluster + "/" + ns + "/" + name
+	cached, hasCached := lookupApplied(key)
 
 	// 2. Define the Suggestion Spec Map
 	newSpec := map[string]interface{}{
@@ -58,68 +145,113 @@ func UpdateOrReport(client dynamic.Interface, workload unstructured.Unstructured
 		"memoryLimit":   suggestion.MemoryLimit,
 		"status":        suggestion.Status,
 		"source":        suggestion.Source,
+		"memoryMetric":  suggestion.MemoryMetric,
+	}
+	if patch != nil {
+		newSpec["patch"] = patch
 	}
 
 	suggestionObj := &unstructured.Unstructured{
 		Object: map[string]interface{}{
 			"apiVersion": "suggester.krs.io/v1alpha1",
 			"kind":       "ResourceSuggestion",
-			"metadata": map[string]interface{}{
-				"name":      name,
-				"namespace": ns,
-				"ownerReferences": []interface{}{
-					map[string]interface{}{
-						"apiVersion": ownerRef.APIVersion,
-						"kind":       ownerRef.Kind,
-						"name":       ownerRef.Name,
-						"uid":        ownerRef.UID,
-						"controller": *ownerRef.Controller,
-					},
-				},
-			},
-			"spec": newSpec,
+			"metadata":   metadata,
+			"spec":       newSpec,
 		},
 	}
 
-	// 3. Check if exists
-	existing, err := client.Resource(suggestionGVR).Namespace(ns).Get(ctx, name, metav1.GetOptions{})
-	if err == nil {
-		// UPDATE
+	// 3. Skip the API call if we applied exactly this recently
+	desired, err := json.Marshal(suggestionObj.Object)
+	if err != nil {
+		return false, fmt.Errorf("failed to encode suggestion: %v", err)
+	}
+	state := appliedState{
+		object:          string(desired),
+		resourceVersion: cached.resourceVersion,
+		conditions:      previous.conditions,
+		spec:            newSpec,
+		history:         previous.history,
+		published:       published,
+	}
+	changed := false
 
-		// Check for changes to avoid noise
-		existingSpec, found, _ := unstructured.NestedMap(existing.Object, "spec")
-		if found {
-			if isSpecEqual(existingSpec, newSpec) {
-				return false, nil // No change
-			}
+	specApplied := !hasCached || cached.object != state.object
+	if specApplied {
+		// 4. Server-side apply: we own only the fields we set, so labels, annotations
+		// or other fields added by people or other controllers are left alone
+		result, err := client.Resource(suggestionGVR).Namespace(ns).Apply(ctx, name, suggestionObj, metav1.ApplyOptions{
+			FieldManager: FieldManager,
+			Force:        true,
+		})
+		if err != nil {
+			forgetApplied(key)
+			return false, fmt.Errorf("failed to apply suggestion: %v", err)
 		}
+		metrics.SuggestionWrites.WithLabelValues("apply").Inc()
 
-		suggestionObj.SetResourceVersion(existing.GetResourceVersion())
+		// An apply that changes nothing keeps the resourceVersion
+		changed = !hasCached || result.GetResourceVersion() != cached.resourceVersion
+		state.resourceVersion = result.GetResourceVersion()
+		current := statusFrom(result)
+		state.conditions, state.history = current.Conditions, current.History
+		recordStatusChange(target, &workload, previous.spec, newSpec)
+	}
 
-		_, err = client.Resource(suggestionGVR).Namespace(ns).Update(ctx, suggestionObj, metav1.UpdateOptions{})
-		if err != nil {
-			return false, fmt.Errorf("failed to update suggestion: %v", err)
+	// 5. Status: when and how this recommendation was computed, and how it changed over time.
+	// An unchanged status is only rewritten every statusRefresh, to keep lastUpdated roughly current
+	now := metav1.Now()
+	status := suggestionStatus{
+		ObservedGeneration: workload.GetGeneration(),
+		Window:             suggestion.Window,
+		Samples:            suggestion.Samples,
+		Conditions:         state.conditions,
+		History:            appendHistory(state.history, historyEntry(suggestion, now), config.Get().History),
+	}
+	setRefreshedConditions(&status, suggestion)
+	state.conditions, state.history = status.Conditions, status.History
+	content, err := json.Marshal(status)
+	if err != nil {
+		return changed, fmt.Errorf("failed to encode suggestion status: %v", err)
+	}
+	state.status, state.statusAt = string(content), cached.statusAt
+	if !specApplied && cached.status == state.status && now.Sub(cached.statusAt) < statusRefresh {
+		storeApplied(key, state)
+		return changed, nil
+	}
+	status.LastUpdated = now
+	state.statusAt = now.Time
+	storeApplied(key, state)
+
+	if err := applyStatus(ctx, client, ns, name, status); err != nil {
+		forgetApplied(key) // Re-apply the spec next time, in case the CR was deleted
+		return changed, fmt.Errorf("failed to update suggestion status: %v", err)
+	}
+	return changed, nil
+}
+
+// MarkStale records on a workload's existing suggestions that the last refresh produced no data.
+// The spec is left as it was, so the previous recommendation stays visible.
+func MarkStale(ctx context.Context, client dynamic.Interface, target Target, workload unstructured.Unstructured, reason, message string) error {
+	var errs []error
+	for _, container := range containerNames(workload) {
+		name, ns := suggestionName(target, workload.GetNamespace(), workload.GetName(), workload.GetKind(), container)
+		existing, err := client.Resource(suggestionGVR).Namespace(ns).Get(ctx, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			continue // Never had a recommendation
 		}
-		return true, nil
-	} else {
-		// CREATE
-		_, err = client.Resource(suggestionGVR).Namespace(ns).Create(ctx, suggestionObj, metav1.CreateOptions{})
 		if err != nil {
-			return false, fmt.Errorf("failed to create suggestion: %v", err)
+			errs = append(errs, fmt.Errorf("failed to get suggestion %s: %v", name, err))
+			continue
 		}
-		return true, nil
-	}
-}
 
-func isSpecEqual(oldSpec, newSpec map[string]interface{}) bool {
-	// Compare key fields
-	keys := []string{"cpuRequest", "cpuLimit", "memoryRequest", "memoryLimit", "status", "source"}
-	for _, k := range keys {
-		v1 := fmt.Sprintf("%v", oldSpec[k])
-		v2 := fmt.Sprintf("%v", newSpec[k])
-		if v1 != v2 {
-			return false
+		status := statusFrom(existing)
+		setStaleConditions(&status, workload.GetGeneration(), reason, message)
+		// Re-read the conditions on the next successful refresh
+		forgetApplied(target.Cluster + "/" + ns + "/" + name)
+
+		if err := applyStatus(ctx, client, ns, name, status); err != nil {
+			errs = append(errs, fmt.Errorf("failed to update suggestion status %s: %v", name, err))
 		}
 	}
-	return true
+	return errors.Join(errs...)
 }
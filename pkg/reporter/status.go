@@ -0,0 +1,165 @@
+package reporter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+
+	"github.com/joe-l-mathew/kube-resource-suggest/pkg/engine"
+	"github.com/joe-l-mathew/kube-resource-suggest/pkg/metrics"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+)
+
+// Condition types on a ResourceSuggestion
+const (
+	// ConditionDataAvailable is True when the last refresh found usage data
+	ConditionDataAvailable = "DataAvailable"
+	// ConditionSourceHealthy is True when Prometheus answered, False when a fallback source was used
+	ConditionSourceHealthy = "SourceHealthy"
+	// ConditionStale is True when the last refresh failed and the spec is from an earlier scan
+	ConditionStale = "Stale"
+)
+
+// Condition reasons
+const (
+	ReasonUsageFound          = "UsageFound"
+	ReasonPrometheusAvailable = "PrometheusAvailable"
+	ReasonRefreshed           = "Refreshed"
+	ReasonNoData              = "NoData"
+)
+
+// suggestionStatus is the status subresource of a ResourceSuggestion
+type suggestionStatus struct {
+	// LastUpdated is when the status last changed, or was last refreshed (at least every statusRefresh)
+	LastUpdated metav1.Time `json:"lastUpdated,omitempty"`
+	// ObservedGeneration is the workload's metadata.generation at that time
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Window is the usage window analysed, e.g. "72h", or "instant"
+	Window string `json:"window,omitempty"`
+	// Samples is the number of pods that contributed usage
+	Samples    int64              `json:"samples,omitempty"`
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// History lists the recommendation changes, oldest first
+	History []HistoryEntry `json:"history,omitempty"`
+}
+
+// statusUnsupported is set once the CRD turns out to have no status subresource
+var statusUnsupported atomic.Bool
+
+// statusFrom reads the status of a ResourceSuggestion; unreadable fields are left empty
+func statusFrom(obj *unstructured.Unstructured) suggestionStatus {
+	var status suggestionStatus
+	raw, found, _ := unstructured.NestedMap(obj.Object, "status")
+	if !found {
+		return status
+	}
+	if data, err := json.Marshal(raw); err == nil {
+		_ = json.Unmarshal(data, &status)
+	}
+	return status
+}
+
+// setRefreshedConditions marks a suggestion as freshly computed from s
+func setRefreshedConditions(status *suggestionStatus, s *engine.SuggestionResult) {
+	gen := status.ObservedGeneration
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:               ConditionDataAvailable,
+		Status:             metav1.ConditionTrue,
+		Reason:             ReasonUsageFound,
+		Message:            fmt.Sprintf("%d pod(s) sampled from %s over %s", s.Samples, s.Source, s.Window),
+		ObservedGeneration: gen,
+	})
+
+	healthy := metav1.Condition{
+		Type:               ConditionSourceHealthy,
+		Status:             metav1.ConditionTrue,
+		Reason:             ReasonPrometheusAvailable,
+		Message:            "Prometheus returned usage history",
+		ObservedGeneration: gen,
+	}
+	if s.FallbackReason != "" {
+		healthy.Status = metav1.ConditionFalse
+		healthy.Reason = s.FallbackReason
+		healthy.Message = fmt.Sprintf("Prometheus was not used; fell back to %s", s.Source)
+	}
+	meta.SetStatusCondition(&status.Conditions, healthy)
+
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:               ConditionStale,
+		Status:             metav1.ConditionFalse,
+		Reason:             ReasonRefreshed,
+		Message:            "Recommendation is up to date",
+		ObservedGeneration: gen,
+	})
+}
+
+// setStaleConditions marks a suggestion's spec as left over from an earlier scan
+func setStaleConditions(status *suggestionStatus, gen int64, reason, message string) {
+	for _, t := range []string{ConditionDataAvailable, ConditionStale} {
+		c := metav1.Condition{
+			Type:               t,
+			Status:             metav1.ConditionTrue,
+			Reason:             reason,
+			Message:            message,
+			ObservedGeneration: gen,
+		}
+		if t == ConditionDataAvailable {
+			c.Status = metav1.ConditionFalse
+		}
+		meta.SetStatusCondition(&status.Conditions, c)
+	}
+}
+
+// applyStatus writes status with server-side apply. If the installed CRD predates the
+// status subresource this is logged once and status writes are skipped.
+func applyStatus(ctx context.Context, client dynamic.Interface, ns, name string, status suggestionStatus) error {
+	if statusUnsupported.Load() {
+		return nil
+	}
+
+	data, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	obj := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "suggester.krs.io/v1alpha1",
+			"kind":       "ResourceSuggestion",
+			"metadata": map[string]interface{}{
+				"name":      name,
+				"namespace": ns,
+			},
+			"status": raw,
+		},
+	}
+
+	_, err = client.Resource(suggestionGVR).Namespace(ns).ApplyStatus(ctx, name, obj, metav1.ApplyOptions{
+		FieldManager: FieldManager,
+		Force:        true,
+	})
+	if apierrors.IsNotFound(err) {
+		var statusErr *apierrors.StatusError
+		if errors.As(err, &statusErr) && statusErr.ErrStatus.Details != nil && statusErr.ErrStatus.Details.Name == name {
+			return err // The suggestion itself is gone, e.g. deleted by hand
+		}
+		if statusUnsupported.CompareAndSwap(false, true) {
+			slog.Warn("ResourceSuggestion CRD has no status subresource; re-apply the CRD to get status. Skipping status updates", "error", err)
+		}
+		return nil
+	}
+	if err == nil {
+		metrics.SuggestionWrites.WithLabelValues("status").Inc()
+	}
+	return err
+}
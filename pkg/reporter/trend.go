@@ -0,0 +1,127 @@
+package reporter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/dynamic"
+)
+
+// TrendSource is where one cluster's suggestions are read from
+type TrendSource struct {
+	Client dynamic.Interface
+	Target Target
+}
+
+// ContainerTrend is the recommendation history of one container of a workload
+type ContainerTrend struct {
+	Cluster    string         `json:"cluster,omitempty"`
+	Namespace  string         `json:"namespace"`
+	Workload   string         `json:"workload"`
+	Kind       string         `json:"kind"`
+	Container  string         `json:"container"`
+	Suggestion string         `json:"suggestion"`
+	History    []HistoryEntry `json:"history"`
+}
+
+// Trend returns the recommendation history of each container of a workload.
+// kind may be empty to match any kind.
+func Trend(ctx context.Context, src TrendSource, namespace, workload, kind string) ([]ContainerTrend, error) {
+	suggestions, err := workloadSuggestions(ctx, src, namespace, workload, kind)
+	if err != nil {
+		return nil, err
+	}
+
+	trends := make([]ContainerTrend, 0, len(suggestions))
+	for _, s := range suggestions {
+		history := statusFrom(&s).History
+		if history == nil {
+			history = []HistoryEntry{}
+		}
+		trends = append(trends, ContainerTrend{
+			Cluster:    src.Target.Cluster,
+			Namespace:  namespace,
+			Workload:   workload,
+			Kind:       s.GetLabels()[KindLabel],
+			Container:  s.GetLabels()[ContainerLabel],
+			Suggestion: s.GetName(),
+			History:    history,
+		})
+	}
+	sort.Slice(trends, func(i, j int) bool {
+		if trends[i].Kind != trends[j].Kind {
+			return trends[i].Kind < trends[j].Kind
+		}
+		return trends[i].Container < trends[j].Container
+	})
+	return trends, nil
+}
+
+// workloadSuggestions lists the ResourceSuggestions of a workload, in the hub if src writes there.
+// kind may be empty to match any kind.
+func workloadSuggestions(ctx context.Context, src TrendSource, namespace, workload, kind string) ([]unstructured.Unstructured, error) {
+	selector := labels.Set{WorkloadLabel: labelValue(workload)}
+	if kind != "" {
+		selector[KindLabel] = kind
+	}
+	readNs := namespace
+	if src.Target.HubNamespace != "" {
+		readNs = src.Target.HubNamespace
+		selector[ClusterLabel] = src.Target.Cluster
+		selector[SourceNamespaceLabel] = namespace
+	}
+	return listSuggestions(ctx, src.Client, readNs, selector.String())
+}
+
+// TrendHandler serves a workload's recommendation history as JSON:
+// GET /trend?namespace=<ns>&workload=<name>[&kind=<Kind>][&cluster=<name>].
+// sources is keyed by cluster name ("" in single-cluster mode).
+func TrendHandler(sources map[string]TrendSource) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		q := r.URL.Query()
+		namespace, workload := q.Get("namespace"), q.Get("workload")
+		if namespace == "" || workload == "" {
+			http.Error(w, "namespace and workload are required", http.StatusBadRequest)
+			return
+		}
+
+		cluster := q.Get("cluster")
+		src, ok := sources[cluster]
+		if !ok && cluster == "" && len(sources) == 1 {
+			for _, only := range sources {
+				src, ok = only, true
+			}
+		}
+		if !ok {
+			if cluster == "" {
+				http.Error(w, "cluster is required in multi-cluster mode", http.StatusBadRequest)
+			} else {
+				http.Error(w, fmt.Sprintf("unknown cluster %q", cluster), http.StatusNotFound)
+			}
+			return
+		}
+
+		trends, err := Trend(r.Context(), src, namespace, workload, q.Get("kind"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		if len(trends) == 0 {
+			http.Error(w, "no suggestions found for this workload", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(trends)
+	})
+}
@@ -2,10 +2,11 @@ package scanner
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
-	"os"
-	"strings"
+	"time"
+
+	"github.com/joe-l-mathew/kube-resource-suggest/pkg/config"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
@@ -22,38 +23,85 @@ var targetResources = []struct {
 	{schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "daemonsets"}, "DaemonSet"},
 }
 
-func ListWorkloads(client dynamic.Interface) ([]unstructured.Unstructured, error) {
-	var allWorkloads []unstructured.Unstructured
-	ctx := context.TODO()
+// listPageTimeout bounds each paginated List call
+const listPageTimeout = 30 * time.Second
 
-	ignoredNamespaces := map[string]bool{
-		"kube-system": true,
-	}
+// ScanResult is the outcome of listing workloads, keyed by resource (e.g. "deployments")
+type ScanResult struct {
+	Workloads []unstructured.Unstructured
+	// Counts is the number of workloads kept per resource
+	Counts map[string]int
+	// Errors holds the list error per resource. A failed resource may still
+	// contribute the pages that were fetched before the error.
+	Errors map[string]error
+	// WatchNamespaces (all if empty) and IgnoredNamespaces are the configuration the scan used
+	WatchNamespaces   []string
+	IgnoredNamespaces []string
+}
+
+// Partial reports whether some resources could not be listed
+func (r *ScanResult) Partial() bool {
+	return len(r.Errors) > 0
+}
+
+// Failed reports whether every resource failed and nothing was listed
+func (r *ScanResult) Failed() bool {
+	return len(r.Errors) == len(targetResources) && len(r.Workloads) == 0
+}
 
-	if env := os.Getenv("IGNORED_NAMESPACES"); env != "" {
-		ignoredNamespaces = make(map[string]bool)
-		for n := range strings.SplitSeq(env, ",") {
-			ignoredNamespaces[strings.TrimSpace(n)] = true
+// Err joins the per-resource errors, or returns nil
+func (r *ScanResult) Err() error {
+	var errs []error
+	for _, target := range targetResources {
+		if err, ok := r.Errors[target.GVR.Resource]; ok {
+			errs = append(errs, fmt.Errorf("%s: %w", target.GVR.Resource, err))
 		}
 	}
+	return errors.Join(errs...)
+}
+
+// ListWorkloads lists Deployments, StatefulSets and DaemonSets cluster-wide, or only in
+// watchNamespaces (namespace-scoped mode, which needs just Role-level permissions).
+// Finding no workloads is not an error; failures are reported per resource in the result.
+// The error is only set when ctx is cancelled.
+func ListWorkloads(ctx context.Context, client dynamic.Interface) (*ScanResult, error) {
+	cfg := config.Get()
+	result := &ScanResult{
+		Counts:            map[string]int{},
+		Errors:            map[string]error{},
+		WatchNamespaces:   cfg.WatchNamespaces,
+		IgnoredNamespaces: cfg.IgnoredNamespaces,
+	}
+
+	ignoredNamespaces := make(map[string]bool)
+	for _, n := range cfg.IgnoredNamespaces {
+		ignoredNamespaces[n] = true
+	}
+
+	namespaces := cfg.WatchNamespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
 
 	for _, target := range targetResources {
-		// Pagination Logic: Process in chunks to reduce API Server load
-		continueToken := ""
-		for {
-			listOptions := metav1.ListOptions{
-				Limit:    100, // Fetch 100 items at a time
-				Continue: continueToken,
-			}
+		resource := target.GVR.Resource
+		result.Counts[resource] = 0
 
-			list, err := client.Resource(target.GVR).List(ctx, listOptions)
+		var errs []error
+		for _, namespace := range namespaces {
+			workloads, err := listResource(ctx, client, target.GVR, namespace)
 			if err != nil {
-				// Log error but continue to next resource type (don't crash the bot)
-				log.Printf("Error listing %s: %v", target.GVR.Resource, err)
-				break
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+				// Record the error and continue with the next namespace/resource type
+				if namespace != metav1.NamespaceAll {
+					err = fmt.Errorf("namespace %s: %w", namespace, err)
+				}
+				errs = append(errs, err)
 			}
 
-			for _, item := range list.Items {
+			for _, item := range workloads {
 				ns := item.GetNamespace()
 
 				// Optimization: Filter strictly before appending
@@ -64,20 +112,43 @@ func ListWorkloads(client dynamic.Interface) ([]unstructured.Unstructured, error
 
 				// Fix: Explicitly set the Kind so the Engine knows what this is
 				item.SetKind(target.Kind)
-				allWorkloads = append(allWorkloads, item)
-			}
-
-			// Check if there are more pages
-			continueToken = list.GetContinue()
-			if continueToken == "" {
-				break
+				result.Workloads = append(result.Workloads, item)
+				result.Counts[resource]++
 			}
 		}
+		if len(errs) > 0 {
+			result.Errors[resource] = errors.Join(errs...)
+		}
 	}
 
-	if len(allWorkloads) == 0 {
-		return nil, fmt.Errorf("scanned all types but found 0 workloads (Check RBAC permissions!)")
-	}
+	return result, nil
+}
 
-	return allWorkloads, nil
+// listResource pages through one resource type in namespace ("" for all namespaces).
+// Items fetched before an error are returned along with it.
+func listResource(ctx context.Context, client dynamic.Interface, gvr schema.GroupVersionResource, namespace string) ([]unstructured.Unstructured, error) {
+	var items []unstructured.Unstructured
+
+	// Pagination Logic: Process in chunks to reduce API Server load
+	continueToken := ""
+	for {
+		listOptions := metav1.ListOptions{
+			Limit:    100, // Fetch 100 items at a time
+			Continue: continueToken,
+		}
+
+		pageCtx, cancel := context.WithTimeout(ctx, listPageTimeout)
+		list, err := client.Resource(gvr).Namespace(namespace).List(pageCtx, listOptions)
+		cancel()
+		if err != nil {
+			return items, err
+		}
+		items = append(items, list.Items...)
+
+		// Check if there are more pages
+		continueToken = list.GetContinue()
+		if continueToken == "" {
+			return items, nil
+		}
+	}
 }
@@ -0,0 +1,129 @@
+package status
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
+)
+
+// ConditionType is the condition on the controller's own Pod that reflects the last scan
+const ConditionType corev1.PodConditionType = "krs.io/ScanSucceeded"
+
+// Event and condition reasons
+const (
+	ReasonScanSucceeded       = "ScanSucceeded"
+	ReasonScanPartiallyFailed = "ScanPartiallyFailed"
+	ReasonScanFailed          = "ScanFailed"
+	ReasonScanRecovered       = "ScanRecovered"
+)
+
+// maxMessageLength keeps event and condition messages readable
+const maxMessageLength = 1024
+
+// Reporter surfaces scan outcomes as Events and a condition on the controller Pod.
+// Outside a Pod (no POD_NAME) it only logs.
+type Reporter struct {
+	client   kubernetes.Interface
+	recorder record.EventRecorder
+	pod      *corev1.ObjectReference
+
+	mu                 sync.Mutex
+	lastReason         string
+	lastMessage        string
+	lastTransitionTime metav1.Time
+}
+
+// NewReporter returns a Reporter for the Pod namespace/name (uid is optional but lets
+// `kubectl describe pod` find the events)
+func NewReporter(client kubernetes.Interface, recorder record.EventRecorder, namespace, name, uid string) *Reporter {
+	r := &Reporter{client: client, recorder: recorder}
+	if name != "" && namespace != "" {
+		r.pod = &corev1.ObjectReference{
+			APIVersion: "v1",
+			Kind:       "Pod",
+			Namespace:  namespace,
+			Name:       name,
+			UID:        types.UID(uid),
+		}
+	}
+	return r
+}
+
+// ScanFinished reports the outcome of a scan. problems lists everything that could not be
+// listed (empty for a clean scan); failed means nothing could be scanned at all.
+func (r *Reporter) ScanFinished(ctx context.Context, problems []string, failed bool) {
+	reason, status := ReasonScanSucceeded, corev1.ConditionTrue
+	message := "All workload types listed"
+	if len(problems) > 0 {
+		reason, status = ReasonScanPartiallyFailed, corev1.ConditionFalse
+		if failed {
+			reason = ReasonScanFailed
+		}
+		message = truncate(strings.Join(problems, "; "))
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	recovered := reason == ReasonScanSucceeded && r.lastReason != "" && r.lastReason != ReasonScanSucceeded
+	changed := reason != r.lastReason || message != r.lastMessage
+	if reason != r.lastReason {
+		r.lastTransitionTime = metav1.Now()
+	}
+	r.lastReason, r.lastMessage = reason, message
+
+	if r.pod == nil {
+		return
+	}
+
+	// 1. Events: every failing scan (the correlator aggregates repeats), and recovery once
+	switch {
+	case len(problems) > 0:
+		r.recorder.Event(r.pod, corev1.EventTypeWarning, reason, message)
+	case recovered:
+		r.recorder.Event(r.pod, corev1.EventTypeNormal, ReasonScanRecovered, message)
+	}
+
+	// 2. Pod condition, patched only when it changes
+	if changed {
+		if err := r.patchCondition(ctx, status, reason, message); err != nil {
+			slog.Warn("Failed to update controller pod condition", "condition", ConditionType, "error", err)
+		}
+	}
+}
+
+func (r *Reporter) patchCondition(ctx context.Context, status corev1.ConditionStatus, reason, message string) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"status": map[string]interface{}{
+			"conditions": []corev1.PodCondition{{
+				Type:               ConditionType,
+				Status:             status,
+				Reason:             reason,
+				Message:            message,
+				LastProbeTime:      metav1.NewTime(time.Now()),
+				LastTransitionTime: r.lastTransitionTime,
+			}},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = r.client.CoreV1().Pods(r.pod.Namespace).Patch(ctx, r.pod.Name, types.StrategicMergePatchType, patch, metav1.PatchOptions{}, "status")
+	return err
+}
+
+func truncate(s string) string {
+	if len(s) <= maxMessageLength {
+		return s
+	}
+	return s[:maxMessageLength-3] + "..."
+}
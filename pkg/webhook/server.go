@@ -0,0 +1,73 @@
+package webhook
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Serve serves handler over HTTPS on addr until ctx is cancelled, with the certificate and key
+// in certDir (tls.crt, tls.key). They are reloaded when they change, e.g. on rotation by cert-manager.
+func Serve(ctx context.Context, addr, certDir string, handler http.Handler) error {
+	certs := &certLoader{certFile: filepath.Join(certDir, "tls.crt"), keyFile: filepath.Join(certDir, "tls.key")}
+	if _, err := certs.get(nil); err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(Path, handler)
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		TLSConfig:         &tls.Config{MinVersion: tls.VersionTLS12, GetCertificate: certs.get},
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	if err := srv.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// certLoader reloads a key pair when the certificate file's modification time changes
+type certLoader struct {
+	certFile, keyFile string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+// get returns the current key pair, keeping the previous one if a reload fails
+func (l *certLoader) get(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	info, err := os.Stat(l.certFile)
+	if err == nil && info.ModTime().Equal(l.modTime) {
+		return l.cert, nil
+	}
+	if err == nil {
+		var cert tls.Certificate
+		if cert, err = tls.LoadX509KeyPair(l.certFile, l.keyFile); err == nil {
+			l.cert, l.modTime = &cert, info.ModTime()
+			return l.cert, nil
+		}
+	}
+	if l.cert != nil {
+		return l.cert, nil // Mid-rotation: serve the previous pair
+	}
+	return nil, fmt.Errorf("failed to load webhook certificate: %v", err)
+}
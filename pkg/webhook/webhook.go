@@ -0,0 +1,207 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/joe-l-mathew/kube-resource-suggest/pkg/metrics"
+	"github.com/joe-l-mathew/kube-resource-suggest/pkg/reporter"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// NamespaceLabel opts a namespace into injection with "true". It is matched by the
+// namespaceSelector of the MutatingWebhookConfiguration.
+const NamespaceLabel = "krs.io/inject-resources"
+
+// OptOutAnnotation set to "false" on a pod (template) leaves the pod unchanged
+const OptOutAnnotation = "krs.io/inject-resources"
+
+// InjectedAnnotation records on a pod which resources the webhook changed
+const InjectedAnnotation = "krs.io/injected-resources"
+
+// Path is where the webhook serves admission reviews
+const Path = "/mutate-pods"
+
+// maxRequestBytes bounds an AdmissionReview body
+const maxRequestBytes = 3 << 20
+
+// Outcomes of an admission request, used as metric labels
+const (
+	outcomeInjected  = "injected"
+	outcomeUnchanged = "unchanged"
+	outcomeSkipped   = "skipped"
+	outcomeError     = "error"
+)
+
+// Handler serves pod admission reviews, setting the container resources of new pods to their
+// workload's recommendation read from src. It fails open: a pod that cannot be looked up within
+// timeout, or fails any other way, is admitted unchanged.
+func Handler(src reporter.TrendSource, timeout time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var review admissionv1.AdmissionReview
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBytes)).Decode(&review); err != nil || review.Request == nil {
+			http.Error(w, "invalid AdmissionReview", http.StatusBadRequest)
+			return
+		}
+		req := review.Request
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		response := &admissionv1.AdmissionResponse{UID: req.UID, Allowed: true}
+		patch, outcome, err := mutate(ctx, src, req)
+		if err != nil {
+			outcome = outcomeError
+			slog.Warn("Admitting pod unchanged", "namespace", req.Namespace, "name", req.Name, "error", err)
+		} else if patch != nil {
+			patchType := admissionv1.PatchTypeJSONPatch
+			response.Patch, response.PatchType = patch, &patchType
+		}
+		metrics.WebhookRequests.WithLabelValues(outcome).Inc()
+
+		review.Request, review.Response = nil, response
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(review); err != nil {
+			slog.Debug("Failed to write admission response", "error", err)
+		}
+	})
+}
+
+// mutate returns the JSON patch setting the recommended resources on the pod in req,
+// or nil if there is nothing to change
+func mutate(ctx context.Context, src reporter.TrendSource, req *admissionv1.AdmissionRequest) ([]byte, string, error) {
+	// 1. New pods only
+	if req.Operation != admissionv1.Create || req.Kind.Kind != "Pod" || req.SubResource != "" {
+		return nil, outcomeSkipped, nil
+	}
+	var pod corev1.Pod
+	if err := json.Unmarshal(req.Object.Raw, &pod); err != nil {
+		return nil, outcomeError, fmt.Errorf("failed to decode pod: %v", err)
+	}
+	if pod.Annotations[OptOutAnnotation] == "false" {
+		return nil, outcomeSkipped, nil
+	}
+	workload, kind, ok := owner(&pod)
+	if !ok {
+		return nil, outcomeSkipped, nil
+	}
+
+	// 2. The workload's recommendation. The pod's name and namespace may not be set yet
+	recommended, err := reporter.Recommendations(ctx, src, req.Namespace, workload, kind)
+	if err != nil {
+		return nil, outcomeError, fmt.Errorf("failed to read suggestions of %s %s: %v", kind, workload, err)
+	}
+
+	// 3. Replace each recommended container's resources, keeping anything not recommended.
+	// Limits are only changed where the pod sets one. A resource whose request would end up
+	// above its limit is left as it is
+	var ops []map[string]interface{}
+	var changes []string
+	for i, c := range pod.Spec.Containers {
+		rec, ok := recommended[c.Name]
+		if !ok {
+			continue
+		}
+		resources := c.Resources.DeepCopy()
+		var changed []string
+		for _, name := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+			request, hasRequest := resources.Requests[name]
+			limit, hasLimit := resources.Limits[name]
+			newRequest, newLimit := request, limit
+			if value, ok := rec.Requests[name]; ok {
+				newRequest = value
+			}
+			if value, ok := rec.Limits[name]; ok && hasLimit {
+				newLimit = value
+			}
+			if hasLimit && newRequest.Cmp(newLimit) > 0 {
+				continue
+			}
+
+			if newRequest.Cmp(request) != 0 {
+				if resources.Requests == nil {
+					resources.Requests = corev1.ResourceList{}
+				}
+				resources.Requests[name] = newRequest
+				changed = append(changed, fmt.Sprintf("%s %s->%s", resourceLabel(name, "request"), quantity(request, hasRequest), newRequest.String()))
+			}
+			if hasLimit && newLimit.Cmp(limit) != 0 {
+				resources.Limits[name] = newLimit
+				changed = append(changed, fmt.Sprintf("%s %s->%s", resourceLabel(name, "limit"), limit.String(), newLimit.String()))
+			}
+		}
+		if len(changed) == 0 {
+			continue
+		}
+		ops = append(ops, map[string]interface{}{"op": "add", "path": fmt.Sprintf("/spec/containers/%d/resources", i), "value": resources})
+		changes = append(changes, fmt.Sprintf("container %s: %s", c.Name, strings.Join(changed, ", ")))
+	}
+	if len(ops) == 0 {
+		return nil, outcomeUnchanged, nil
+	}
+
+	// 4. Record what changed on the pod
+	summary := strings.Join(changes, "; ")
+	if pod.Annotations == nil {
+		ops = append(ops, map[string]interface{}{"op": "add", "path": "/metadata/annotations", "value": map[string]string{InjectedAnnotation: summary}})
+	} else {
+		ops = append(ops, map[string]interface{}{"op": "add", "path": "/metadata/annotations/" + escape(InjectedAnnotation), "value": summary})
+	}
+	patch, err := json.Marshal(ops)
+	if err != nil {
+		return nil, outcomeError, err
+	}
+	return patch, outcomeInjected, nil
+}
+
+// owner returns the workload a pod belongs to. Pods of a ReplicaSet belong to the Deployment whose
+// name is the ReplicaSet's without the pod-template-hash suffix.
+func owner(pod *corev1.Pod) (string, string, bool) {
+	ref := metav1.GetControllerOfNoCopy(pod)
+	if ref == nil {
+		return "", "", false
+	}
+	switch ref.Kind {
+	case "ReplicaSet":
+		hash := pod.Labels["pod-template-hash"]
+		if hash == "" || !strings.HasSuffix(ref.Name, "-"+hash) {
+			return "", "", false
+		}
+		return strings.TrimSuffix(ref.Name, "-"+hash), "Deployment", true
+	case "StatefulSet", "DaemonSet":
+		return ref.Name, ref.Kind, true
+	}
+	return "", "", false
+}
+
+// resourceLabel names a resource in the change summary, e.g. "CPU request"
+func resourceLabel(name corev1.ResourceName, kind string) string {
+	if name == corev1.ResourceCPU {
+		return "CPU " + kind
+	}
+	return string(name) + " " + kind
+}
+
+// quantity formats a current value, or "unset"
+func quantity(q resource.Quantity, set bool) string {
+	if !set {
+		return "unset"
+	}
+	return q.String()
+}
+
+// escape escapes a JSON pointer token
+func escape(token string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(token)
+}
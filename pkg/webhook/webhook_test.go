@@ -0,0 +1,223 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/joe-l-mathew/kube-resource-suggest/pkg/reporter"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+// ownedPod returns a pod of ReplicaSet api-5d8f with the given resources
+func ownedPod(resources corev1.ResourceRequirements) *corev1.Pod {
+	controller := true
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName:    "api-5d8f-",
+			Labels:          map[string]string{"pod-template-hash": "5d8f"},
+			OwnerReferences: []metav1.OwnerReference{{Kind: "ReplicaSet", Name: "api-5d8f", Controller: &controller}},
+		},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{
+			{Name: "api", Resources: resources},
+			{Name: "sidecar", Resources: resources},
+		}},
+	}
+}
+
+// testSource returns a source with the suggestion of container api of Deployment api in namespace shop:
+// 250m CPU and 256Mi memory requested, limited to 512Mi memory
+func testSource(t *testing.T) reporter.TrendSource {
+	t.Helper()
+	suggestion := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "suggester.krs.io/v1alpha1",
+		"kind":       "ResourceSuggestion",
+		"metadata": map[string]interface{}{
+			"name":      "api-deploy-api-1234",
+			"namespace": "shop",
+			"labels": map[string]interface{}{
+				reporter.WorkloadLabel:  "api",
+				reporter.KindLabel:      "Deployment",
+				reporter.ContainerLabel: "api",
+			},
+		},
+		"spec": map[string]interface{}{
+			"status": "Overprovisioned",
+			"patch": map[string]interface{}{
+				"strategicMerge": `{"spec":{"template":{"spec":{"containers":[{"name":"api","resources":{"requests":{"cpu":"250m","memory":"256Mi"},"limits":{"memory":"512Mi"}}}]}}}}`,
+			},
+		},
+	}}
+	gvr := schema.GroupVersionResource{Group: "suggester.krs.io", Version: "v1alpha1", Resource: "resourcesuggestions"}
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{gvr: "ResourceSuggestionList"}, suggestion)
+	return reporter.TrendSource{Client: client}
+}
+
+// request returns an admission request for pod in namespace shop
+func request(t *testing.T, op admissionv1.Operation, pod *corev1.Pod) *admissionv1.AdmissionRequest {
+	t.Helper()
+	raw, err := json.Marshal(pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &admissionv1.AdmissionRequest{
+		Operation: op,
+		Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+		Namespace: "shop",
+		Object:    runtime.RawExtension{Raw: raw},
+	}
+}
+
+func TestMutate(t *testing.T) {
+	resources := func(requests, limits corev1.ResourceList) corev1.ResourceRequirements {
+		return corev1.ResourceRequirements{Requests: requests, Limits: limits}
+	}
+	list := func(cpu, memory string) corev1.ResourceList {
+		l := corev1.ResourceList{}
+		if cpu != "" {
+			l[corev1.ResourceCPU] = resource.MustParse(cpu)
+		}
+		if memory != "" {
+			l[corev1.ResourceMemory] = resource.MustParse(memory)
+		}
+		return l
+	}
+	optedOut := ownedPod(resources(list("1", "1Gi"), nil))
+	optedOut.Annotations = map[string]string{OptOutAnnotation: "false"}
+	bare := ownedPod(resources(list("1", "1Gi"), nil))
+	bare.OwnerReferences = nil
+
+	tests := []struct {
+		name        string
+		op          admissionv1.Operation
+		pod         *corev1.Pod
+		wantOutcome string
+		wantOps     string // JSON patch
+	}{
+		{
+			name:        "updates are ignored",
+			op:          admissionv1.Update,
+			pod:         ownedPod(resources(list("1", "1Gi"), nil)),
+			wantOutcome: outcomeSkipped,
+		},
+		{
+			name:        "opted out pods are skipped",
+			pod:         optedOut,
+			wantOutcome: outcomeSkipped,
+		},
+		{
+			name:        "pods without a workload are skipped",
+			pod:         bare,
+			wantOutcome: outcomeSkipped,
+		},
+		{
+			name:        "requests are set without adding limits",
+			pod:         ownedPod(resources(list("1", "1Gi"), nil)),
+			wantOutcome: outcomeInjected,
+			wantOps: `[
+				{"op":"add","path":"/spec/containers/0/resources","value":{"requests":{"cpu":"250m","memory":"256Mi"}}},
+				{"op":"add","path":"/metadata/annotations","value":{"krs.io/injected-resources":"container api: CPU request 1->250m, memory request 1Gi->256Mi"}}
+			]`,
+		},
+		{
+			name:        "existing limits are replaced",
+			pod:         ownedPod(resources(nil, list("2", "1Gi"))),
+			wantOutcome: outcomeInjected,
+			wantOps: `[
+				{"op":"add","path":"/spec/containers/0/resources","value":{"limits":{"cpu":"2","memory":"512Mi"},"requests":{"cpu":"250m","memory":"256Mi"}}},
+				{"op":"add","path":"/metadata/annotations","value":{"krs.io/injected-resources":"container api: CPU request unset->250m, memory request unset->256Mi, memory limit 1Gi->512Mi"}}
+			]`,
+		},
+		{
+			name:        "requests above the limit are skipped",
+			pod:         ownedPod(resources(list("100m", "1Gi"), list("200m", ""))),
+			wantOutcome: outcomeInjected,
+			wantOps: `[
+				{"op":"add","path":"/spec/containers/0/resources","value":{"limits":{"cpu":"200m"},"requests":{"cpu":"100m","memory":"256Mi"}}},
+				{"op":"add","path":"/metadata/annotations","value":{"krs.io/injected-resources":"container api: memory request 1Gi->256Mi"}}
+			]`,
+		},
+		{
+			name:        "recommended pods are unchanged",
+			pod:         ownedPod(resources(list("250m", "256Mi"), nil)),
+			wantOutcome: outcomeUnchanged,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			op := tt.op
+			if op == "" {
+				op = admissionv1.Create
+			}
+			patch, outcome, err := mutate(context.Background(), testSource(t), request(t, op, tt.pod))
+			if err != nil {
+				t.Fatalf("mutate() error = %v", err)
+			}
+			if outcome != tt.wantOutcome {
+				t.Errorf("mutate() outcome = %s, want %s", outcome, tt.wantOutcome)
+			}
+			if tt.wantOps == "" {
+				if patch != nil {
+					t.Errorf("mutate() patch = %s, want none", patch)
+				}
+				return
+			}
+			var got, want interface{}
+			if err := json.Unmarshal(patch, &got); err != nil {
+				t.Fatalf("invalid patch %s: %v", patch, err)
+			}
+			if err := json.Unmarshal([]byte(tt.wantOps), &want); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("mutate() patch = %s, want %s", patch, tt.wantOps)
+			}
+		})
+	}
+}
+
+func TestOwner(t *testing.T) {
+	pod := func(kind, name, hash string) *corev1.Pod {
+		p := &corev1.Pod{}
+		if hash != "" {
+			p.Labels = map[string]string{"pod-template-hash": hash}
+		}
+		if kind != "" {
+			controller := true
+			p.OwnerReferences = []metav1.OwnerReference{{Kind: kind, Name: name, Controller: &controller}}
+		}
+		return p
+	}
+	tests := []struct {
+		name               string
+		pod                *corev1.Pod
+		wantName, wantKind string
+		wantOK             bool
+	}{
+		{"ReplicaSet belongs to its Deployment", pod("ReplicaSet", "api-5d8f", "5d8f"), "api", "Deployment", true},
+		{"hyphenated Deployment name", pod("ReplicaSet", "web-api-5d8f", "5d8f"), "web-api", "Deployment", true},
+		{"ReplicaSet without pod-template-hash", pod("ReplicaSet", "api-5d8f", ""), "", "", false},
+		{"ReplicaSet not named after the hash", pod("ReplicaSet", "api", "5d8f"), "", "", false},
+		{"StatefulSet", pod("StatefulSet", "db", ""), "db", "StatefulSet", true},
+		{"DaemonSet", pod("DaemonSet", "agent", ""), "agent", "DaemonSet", true},
+		{"Job", pod("Job", "migrate", ""), "", "", false},
+		{"no controller", pod("", "", ""), "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, kind, ok := owner(tt.pod)
+			if name != tt.wantName || kind != tt.wantKind || ok != tt.wantOK {
+				t.Errorf("owner() = %q, %q, %v; want %q, %q, %v", name, kind, ok, tt.wantName, tt.wantKind, tt.wantOK)
+			}
+		})
+	}
+}